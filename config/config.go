@@ -2,6 +2,9 @@ package config
 
 import (
 	"log"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,3 +15,50 @@ func LoadEnv() {
 		log.Fatal("Error loading .env file")
 	}
 }
+
+// GetInt reads an integer from the environment, falling back to def when unset or invalid
+func GetInt(key string, def int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %d", key, value, def)
+		return def
+	}
+	return n
+}
+
+// GetDuration reads a time.Duration such as "30s" or "5m" from the environment,
+// falling back to def when unset or invalid
+func GetDuration(key string, def time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %v", key, value, def)
+		return def
+	}
+	return d
+}
+
+// GetBool reads a boolean such as "true" or "0" from the environment, falling back to def when
+// unset or invalid
+func GetBool(key string, def bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %v", key, value, def)
+		return def
+	}
+	return b
+}
@@ -1,13 +1,110 @@
 package cleanup
 
 import (
+	"sort"
 	"time"
 
+	"go-noti-server/internal/log"
 	"go-noti-server/internal/notification"
 )
 
-// ScheduleDailyCleanup schedules the CleanupOldNotifications function to run at a specified time every day
-func ScheduleDailyCleanup(duration time.Duration) {
+// Policy decides which finished notifications are deleted. Retention maps a notification status
+// to how long notifications in it are kept after they finish; statuses without a retention, and
+// notifications that are still queued, scheduled or being sent, are never deleted. Deletes run
+// BatchSize notifications at a time, so other writes are not held up for long.
+type Policy struct {
+	Retention map[notification.Status]time.Duration
+	BatchSize int
+}
+
+// RuleReport is what a cleanup removes, or would remove, for one status
+type RuleReport struct {
+	Status    notification.Status
+	Retention time.Duration
+	Cutoff    time.Time
+	notification.CleanupCounts
+}
+
+// Report is the outcome of a cleanup, or of a dry run
+type Report struct {
+	Rules           []RuleReport
+	IdempotencyKeys int64
+}
+
+// deleteExpired is notification.DeleteExpiredNotifications, replaced in tests
+var deleteExpired = notification.DeleteExpiredNotifications
+
+func (p Policy) batchSize() int {
+	if p.BatchSize <= 0 {
+		return 500
+	}
+	return p.BatchSize
+}
+
+// rules returns the statuses the policy deletes, in a stable order, with their cutoff from now
+func (p Policy) rules(now time.Time) []RuleReport {
+	var rules []RuleReport
+	for status, retention := range p.Retention {
+		if retention <= 0 {
+			continue
+		}
+		rules = append(rules, RuleReport{Status: status, Retention: retention, Cutoff: now.Add(-retention)})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Status < rules[j].Status })
+	return rules
+}
+
+// Run deletes what the policy expires, one batch per transaction, and frees the space of each
+// batch before the next
+func Run(policy Policy) (Report, error) {
+	report := Report{Rules: policy.rules(time.Now())}
+
+	for i := range report.Rules {
+		rule := &report.Rules[i]
+		for {
+			counts, err := deleteExpired(rule.Status, rule.Cutoff, policy.batchSize())
+			if err != nil {
+				return report, err
+			}
+			rule.Notifications += counts.Notifications
+			rule.Deliveries += counts.Deliveries
+			rule.Recipients += counts.Recipients
+			rule.IdempotencyKeys += counts.IdempotencyKeys
+
+			if err := notification.CompactDB(); err != nil {
+				return report, err
+			}
+			if counts.Notifications < int64(policy.batchSize()) {
+				break
+			}
+		}
+	}
+
+	keys, err := notification.CleanupExpiredIdempotencyKeys()
+	report.IdempotencyKeys = keys
+	return report, err
+}
+
+// DryRun reports what Run would delete right now without deleting anything
+func DryRun(policy Policy) (Report, error) {
+	report := Report{Rules: policy.rules(time.Now())}
+
+	for i := range report.Rules {
+		rule := &report.Rules[i]
+		counts, err := notification.CountExpiredNotifications(rule.Status, rule.Cutoff)
+		if err != nil {
+			return report, err
+		}
+		rule.CleanupCounts = counts
+	}
+
+	keys, err := notification.CountExpiredIdempotencyKeys()
+	report.IdempotencyKeys = keys
+	return report, err
+}
+
+// ScheduleDailyCleanup runs the policy at midnight every day
+func ScheduleDailyCleanup(policy Policy) {
 	go func() {
 		for {
 			// Calculate the next run time
@@ -23,7 +120,13 @@ func ScheduleDailyCleanup(duration time.Duration) {
 			time.Sleep(time.Until(nextRun))
 
 			// Perform the cleanup
-			notification.CleanupOldNotifications(duration)
+			report, err := Run(policy)
+			for _, rule := range report.Rules {
+				log.InfoLogger.Printf("Cleanup deleted %d %s notifications older than %v", rule.Notifications, rule.Status, rule.Retention)
+			}
+			if err != nil {
+				log.ErrorLogger.Errorf("Cleanup failed: %v", err)
+			}
 		}
 	}()
 }
@@ -0,0 +1,208 @@
+package cleanup
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/notification"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	log.InfoLogger = logrus.New()
+	log.ErrorLogger = logrus.New()
+	log.InfoLogger.SetLevel(logrus.WarnLevel)
+
+	db, err := notification.InitDB(notification.StoreConfig{DSN: t.TempDir() + "/notifications.db"}, true)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { notification.CloseDB() })
+	return db
+}
+
+// save queues a notification with an idempotency key and returns its ID
+func save(t *testing.T, n notification.Notification) uint {
+	t.Helper()
+
+	n.Message = "m"
+	n.Tokens = []string{"a"}
+	n.IdempotencyKey = fmt.Sprintf("key-%d", time.Now().UnixNano())
+	id, _, err := notification.SaveNotification(n)
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	return id
+}
+
+// finish marks a notification finished with status at updatedAt
+func finish(t *testing.T, db *gorm.DB, id uint, status notification.Status, updatedAt time.Time) {
+	t.Helper()
+
+	err := db.Model(&notification.Notification{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"processed":  true,
+		"processing": false,
+		"status":     status,
+		"updated_at": updatedAt,
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// age moves the last update of a notification back to updatedAt without changing anything else
+func age(t *testing.T, db *gorm.DB, id uint, updatedAt time.Time) {
+	t.Helper()
+
+	if err := db.Model(&notification.Notification{}).Where("id = ?", id).UpdateColumn("updated_at", updatedAt).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunOnlyDeletesExpiredFinishedNotifications(t *testing.T) {
+	db := openTestDB(t)
+
+	old := time.Now().Add(-48 * time.Hour)
+	later := time.Now().Add(time.Hour)
+
+	// Claimed first, so that only it is leased
+	sending := save(t, notification.Notification{})
+	if claimed, err := notification.ClaimNotifications("w1", 1, time.Minute); err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimNotifications claimed %d: %v", len(claimed), err)
+	}
+	age(t, db, sending, old)
+
+	// Cancelled while a worker is sending it, which has not let go of it yet
+	cancelledInFlight := save(t, notification.Notification{})
+	if claimed, err := notification.ClaimNotifications("w1", 1, time.Minute); err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimNotifications claimed %d: %v", len(claimed), err)
+	}
+	if _, err := notification.CancelNotification(cancelledInFlight, "test", "test"); err != nil {
+		t.Fatalf("CancelNotification: %v", err)
+	}
+	age(t, db, cancelledInFlight, old)
+
+	queued := save(t, notification.Notification{})
+	age(t, db, queued, old)
+
+	scheduled := save(t, notification.Notification{SendAt: &later})
+	age(t, db, scheduled, old)
+
+	recent := save(t, notification.Notification{})
+	finish(t, db, recent, notification.StatusSent, time.Now())
+
+	failed := save(t, notification.Notification{})
+	finish(t, db, failed, notification.StatusFailed, old)
+
+	var expired []uint
+	for i := 0; i < 3; i++ {
+		id := save(t, notification.Notification{})
+		finish(t, db, id, notification.StatusSent, old)
+		expired = append(expired, id)
+	}
+	cancelled := save(t, notification.Notification{})
+	finish(t, db, cancelled, notification.StatusCancelled, old)
+	expired = append(expired, cancelled)
+
+	policy := Policy{
+		Retention: map[notification.Status]time.Duration{
+			notification.StatusSent:      24 * time.Hour,
+			notification.StatusCancelled: 24 * time.Hour,
+		},
+		BatchSize: 2,
+	}
+
+	dryRun, err := DryRun(policy)
+	if err != nil {
+		t.Fatalf("DryRun: %v", err)
+	}
+
+	// Three sent notifications take two batches of two, one cancelled notification takes one
+	calls := map[notification.Status]int{}
+	deleteExpired = func(status notification.Status, olderThan time.Time, limit int) (notification.CleanupCounts, error) {
+		calls[status]++
+		return notification.DeleteExpiredNotifications(status, olderThan, limit)
+	}
+	t.Cleanup(func() { deleteExpired = notification.DeleteExpiredNotifications })
+
+	report, err := Run(policy)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if calls[notification.StatusSent] != 2 || calls[notification.StatusCancelled] != 1 {
+		t.Errorf("deleted sent notifications in %d batches and cancelled ones in %d, want 2 and 1",
+			calls[notification.StatusSent], calls[notification.StatusCancelled])
+	}
+
+	want := map[notification.Status]notification.CleanupCounts{
+		notification.StatusSent:      {Notifications: 3, Recipients: 3, IdempotencyKeys: 3},
+		notification.StatusCancelled: {Notifications: 1, Recipients: 1, IdempotencyKeys: 1},
+	}
+	for i, rule := range report.Rules {
+		if rule.CleanupCounts != want[rule.Status] {
+			t.Errorf("deleted %+v for %s, want %+v", rule.CleanupCounts, rule.Status, want[rule.Status])
+		}
+		if dryRun.Rules[i].CleanupCounts != rule.CleanupCounts {
+			t.Errorf("dry run reported %+v for %s, Run deleted %+v", dryRun.Rules[i].CleanupCounts, rule.Status, rule.CleanupCounts)
+		}
+	}
+
+	for _, id := range expired {
+		var count int64
+		db.Unscoped().Model(&notification.Notification{}).Where("id = ?", id).Count(&count)
+		if count != 0 {
+			t.Errorf("expired notification %d was kept", id)
+		}
+		db.Model(&notification.IdempotencyKey{}).Where("notification_id = ?", id).Count(&count)
+		if count != 0 {
+			t.Errorf("idempotency key of expired notification %d was kept", id)
+		}
+	}
+
+	kept := map[string]uint{
+		"sending":             sending,
+		"cancelled in flight": cancelledInFlight,
+		"queued":              queued,
+		"scheduled":           scheduled,
+		"recently sent":       recent,
+		"failed":              failed,
+	}
+	for name, id := range kept {
+		var count int64
+		db.Model(&notification.Notification{}).Where("id = ?", id).Count(&count)
+		if count != 1 {
+			t.Errorf("%s notification %d was deleted", name, id)
+		}
+	}
+}
+
+func TestRunStopsAfterAFullLastBatch(t *testing.T) {
+	db := openTestDB(t)
+
+	for i := 0; i < 4; i++ {
+		id := save(t, notification.Notification{})
+		finish(t, db, id, notification.StatusSent, time.Now().Add(-48*time.Hour))
+	}
+
+	// Two full batches, then one that finds nothing
+	calls := 0
+	deleteExpired = func(status notification.Status, olderThan time.Time, limit int) (notification.CleanupCounts, error) {
+		calls++
+		return notification.DeleteExpiredNotifications(status, olderThan, limit)
+	}
+	t.Cleanup(func() { deleteExpired = notification.DeleteExpiredNotifications })
+
+	report, err := Run(Policy{Retention: map[notification.Status]time.Duration{notification.StatusSent: 24 * time.Hour}, BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if calls != 3 || report.Rules[0].Notifications != 4 {
+		t.Errorf("deleted %d notifications in %d batches, want 4 in 3", report.Rules[0].Notifications, calls)
+	}
+}
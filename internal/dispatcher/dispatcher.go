@@ -0,0 +1,195 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/notification"
+)
+
+// Config controls how the dispatcher claims notifications
+type Config struct {
+	// Owner identifies this process in lease columns. Defaults to hostname and pid.
+	Owner           string
+	BatchSize       int
+	PollInterval    time.Duration
+	LeaseDuration   time.Duration
+	ReclaimInterval time.Duration
+}
+
+// Dispatcher leases due notifications from the database and hands them to the workers. Leases
+// are renewed while notifications are in flight and expired leases are returned to the queue,
+// so rows claimed by a process that died are picked up again.
+type Dispatcher struct {
+	cfg Config
+	out chan<- notification.Notification
+}
+
+func New(cfg Config, out chan<- notification.Notification) *Dispatcher {
+	if cfg.Owner == "" {
+		hostname, _ := os.Hostname()
+		cfg.Owner = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+	if cfg.LeaseDuration <= 0 {
+		cfg.LeaseDuration = 5 * time.Minute
+	}
+	if cfg.ReclaimInterval <= 0 {
+		cfg.ReclaimInterval = time.Minute
+	}
+
+	return &Dispatcher{cfg: cfg, out: out}
+}
+
+// Owner returns the lease owner used by this dispatcher
+func (d *Dispatcher) Owner() string {
+	return d.cfg.Owner
+}
+
+// Run claims and dispatches notifications until ctx is cancelled. It only claims as many
+// notifications as the worker channel has room for and blocks while the workers are busy, so a
+// backlog drains as fast as the workers can send it. It only sleeps once the queue is empty.
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.reclaim()
+
+	go d.maintainLeases(ctx)
+
+	for {
+		claimed, ok := d.dispatch(ctx)
+		if !ok {
+			return
+		}
+
+		if claimed > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.cfg.PollInterval):
+		}
+	}
+}
+
+// dispatch claims one round of notifications and blocks until all of them are handed to the
+// workers. It returns false when ctx was cancelled.
+func (d *Dispatcher) dispatch(ctx context.Context) (int, bool) {
+	// Claim at least one so that a full channel blocks the send below rather than spinning
+	free := cap(d.out) - len(d.out)
+	if free < 1 {
+		free = 1
+	}
+	if free > d.cfg.BatchSize {
+		free = d.cfg.BatchSize
+	}
+
+	notifications, err := notification.ClaimNotifications(d.cfg.Owner, free, d.cfg.LeaseDuration)
+	if err != nil {
+		log.InfoLogger.Printf("Failed to claim notifications: %v", err)
+		return 0, true
+	}
+
+	for i, notif := range notifications {
+		select {
+		case d.out <- notif:
+		case <-ctx.Done():
+			d.release(notifications[i:])
+			return i, false
+		}
+	}
+	return len(notifications), true
+}
+
+func (d *Dispatcher) release(notifications []notification.Notification) {
+	for _, notif := range notifications {
+		if err := notification.ReleaseLease(notif.ID, d.cfg.Owner); err != nil {
+			log.ErrorLogger.Printf("Failed to release notification %d: %v", notif.ID, err)
+		}
+	}
+}
+
+// Stats is a snapshot of the notification queue
+type Stats struct {
+	Due            int64
+	Delayed        int64
+	Scheduled      int64
+	Leased         int64
+	Buffered       int
+	BufferCapacity int
+}
+
+// Stats reports how many notifications are waiting in the database and in the worker channel
+func (d *Dispatcher) Stats() (Stats, error) {
+	due, delayed, scheduled, leased, err := notification.QueueDepth()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	return Stats{
+		Due:            due,
+		Delayed:        delayed,
+		Scheduled:      scheduled,
+		Leased:         leased,
+		Buffered:       len(d.out),
+		BufferCapacity: cap(d.out),
+	}, nil
+}
+
+func (d *Dispatcher) recordStats() {
+	stats, err := d.Stats()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to read queue depth: %v", err)
+		return
+	}
+
+	log.NewRelicApp.RecordCustomMetric("Queue/Due", float64(stats.Due))
+	log.NewRelicApp.RecordCustomMetric("Queue/Delayed", float64(stats.Delayed))
+	log.NewRelicApp.RecordCustomMetric("Queue/Scheduled", float64(stats.Scheduled))
+	log.NewRelicApp.RecordCustomMetric("Queue/Leased", float64(stats.Leased))
+	log.NewRelicApp.RecordCustomMetric("Queue/Buffered", float64(stats.Buffered))
+}
+
+// maintainLeases renews this owner's leases well before they expire and periodically reclaims
+// leases other owners let expire
+func (d *Dispatcher) maintainLeases(ctx context.Context) {
+	renew := time.NewTicker(d.cfg.LeaseDuration / 3)
+	defer renew.Stop()
+
+	reclaim := time.NewTicker(d.cfg.ReclaimInterval)
+	defer reclaim.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-renew.C:
+			if _, err := notification.RenewLeases(d.cfg.Owner, d.cfg.LeaseDuration); err != nil {
+				log.ErrorLogger.Printf("Failed to renew leases: %v", err)
+			}
+		case <-reclaim.C:
+			d.reclaim()
+			d.recordStats()
+		}
+	}
+}
+
+func (d *Dispatcher) reclaim() {
+	reclaimed, err := notification.ReclaimExpiredLeases()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to reclaim expired leases: %v", err)
+		return
+	}
+
+	if reclaimed > 0 {
+		log.InfoLogger.Printf("Reclaimed %d notifications with expired leases", reclaimed)
+	}
+}
@@ -0,0 +1,266 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is one numbered step of the schema. Up applies it and Down reverts it, each in a
+// transaction together with the schema_version change, so a failed step leaves nothing behind.
+// Steps that cannot run inside a transaction, such as VACUUM, set NoTransaction; their version is
+// recorded once they succeed, so they must be safe to run again. Steps too slow to run while the
+// server starts, such as rewriting the whole database, set Manual; UpTo lets the caller stop
+// before them and leave them to the migrate command.
+type Migration struct {
+	Version       int
+	Name          string
+	Up            func(tx *gorm.DB) error
+	Down          func(tx *gorm.DB) error
+	NoTransaction bool
+	Manual        bool
+}
+
+// AppliedMigration is a row of the schema_version table
+type AppliedMigration struct {
+	Version   int       `gorm:"primarykey;autoIncrement:false"`
+	Name      string    `gorm:"type:string"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+func (AppliedMigration) TableName() string {
+	return "schema_version"
+}
+
+// ErrAhead is returned when the database has migrations applied that this binary does not know
+var ErrAhead = errors.New("database schema is newer than this binary")
+
+// Current returns the highest version applied to the database, 0 for a new database
+func Current(db *gorm.DB) (int, error) {
+	if err := db.AutoMigrate(&AppliedMigration{}); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := db.Model(&AppliedMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// Latest returns the version the migrations bring the schema to
+func Latest(migrations []Migration) int {
+	latest := 0
+	for _, m := range migrations {
+		if m.Version > latest {
+			latest = m.Version
+		}
+	}
+	return latest
+}
+
+// Check returns how many migrations are waiting to be applied, or ErrAhead when the database
+// is at a version newer than any of migrations
+func Check(db *gorm.DB, migrations []Migration) (int, error) {
+	current, err := Current(db)
+	if err != nil {
+		return 0, err
+	}
+
+	latest := Latest(migrations)
+	if current > latest {
+		return 0, fmt.Errorf("%w: database is at version %d, binary knows up to %d", ErrAhead, current, latest)
+	}
+
+	pending := 0
+	for _, m := range migrations {
+		if m.Version > current {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Pending returns the migrations newer than the database, oldest first, or ErrAhead when the
+// database is at a version newer than any of migrations
+func Pending(db *gorm.DB, migrations []Migration) ([]Migration, error) {
+	sorted, err := sortMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := Check(db, sorted); err != nil {
+		return nil, err
+	}
+	current, err := Current(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range sorted {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every migration newer than the database, in order, and returns how many it applied
+func Up(db *gorm.DB, migrations []Migration) (int, error) {
+	return UpTo(db, migrations, Latest(migrations))
+}
+
+// UpTo applies the migrations newer than the database up to and including version, in order, and
+// returns how many it applied
+func UpTo(db *gorm.DB, migrations []Migration, version int) (int, error) {
+	sorted, err := sortMigrations(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	err = locked(db, func(conn *gorm.DB) error {
+		if _, err := Check(conn, sorted); err != nil {
+			return err
+		}
+		current, err := Current(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range sorted {
+			if m.Version <= current || m.Version > version {
+				continue
+			}
+
+			done := false
+			err := run(conn, m, func(tx *gorm.DB) error {
+				// Another process may have applied the step since current was read
+				already, err := isApplied(tx, m.Version)
+				if err != nil || already {
+					done = already
+					return err
+				}
+				if err := m.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&AppliedMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+			}
+			if !done {
+				applied++
+			}
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps migrations applied to the database and returns how many it reverted
+func Down(db *gorm.DB, migrations []Migration, steps int) (int, error) {
+	sorted, err := sortMigrations(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	err = locked(db, func(conn *gorm.DB) error {
+		if _, err := Check(conn, sorted); err != nil {
+			return err
+		}
+		current, err := Current(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(sorted) - 1; i >= 0 && reverted < steps; i-- {
+			m := sorted[i]
+			if m.Version > current {
+				continue
+			}
+
+			err := run(conn, m, func(tx *gorm.DB) error {
+				if err := m.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&AppliedMigration{}, m.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d %s: %w", m.Version, m.Name, err)
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Applied lists the migrations recorded in the database, oldest first
+func Applied(db *gorm.DB) ([]AppliedMigration, error) {
+	if err := db.AutoMigrate(&AppliedMigration{}); err != nil {
+		return nil, err
+	}
+
+	var applied []AppliedMigration
+	err := db.Order("version").Find(&applied).Error
+	return applied, err
+}
+
+// migrationLock is the key of the Postgres advisory lock held while migrating
+const migrationLock = 7370832016
+
+// locked calls fn on a single connection while no other process is migrating the database, so
+// that replicas starting at the same time with auto-migrate on apply each step once. Postgres
+// holds an advisory lock for the whole run. SQLite only lets one write transaction in at a time,
+// and Up checks inside each step's transaction that it is still pending.
+func locked(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		// A new session per statement, as db.Transaction hands out
+		conn = conn.Session(&gorm.Session{NewDB: true})
+
+		if conn.Dialector.Name() != "postgres" {
+			return fn(conn)
+		}
+
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLock).Error; err != nil {
+			return fmt.Errorf("taking the migration lock: %w", err)
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLock)
+
+		return fn(conn)
+	})
+}
+
+// isApplied reports whether version is recorded in schema_version
+func isApplied(tx *gorm.DB, version int) (bool, error) {
+	var count int64
+	err := tx.Model(&AppliedMigration{}).Where("version = ?", version).Count(&count).Error
+	return count > 0, err
+}
+
+// run calls fn in a transaction on conn, or directly on conn for steps that set NoTransaction
+func run(conn *gorm.DB, m Migration, fn func(tx *gorm.DB) error) error {
+	if m.NoTransaction {
+		return fn(conn)
+	}
+	return conn.Transaction(fn)
+}
+
+func sortMigrations(migrations []Migration) ([]Migration, error) {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migration %s has invalid version %d", m.Name, m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", sorted[i-1].Name, m.Name, m.Version)
+		}
+	}
+	return sorted, nil
+}
@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// counted returns migrations that each create a table and count how often they ran
+func counted(runs map[int]int, mu *sync.Mutex) []Migration {
+	var migrations []Migration
+	for version := 1; version <= 5; version++ {
+		version := version
+		table := fmt.Sprintf("migrate_test_%d", version)
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    table,
+			Up: func(tx *gorm.DB) error {
+				mu.Lock()
+				runs[version]++
+				mu.Unlock()
+				// Long enough for the other processes to read the version before this one commits
+				time.Sleep(10 * time.Millisecond)
+				return tx.Exec(fmt.Sprintf("CREATE TABLE %s (id integer)", table)).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Exec(fmt.Sprintf("DROP TABLE %s", table)).Error
+			},
+		})
+	}
+	return migrations
+}
+
+// upConcurrently runs Up from every connection at once and checks each step ran exactly once
+func upConcurrently(t *testing.T, conns []*gorm.DB) {
+	t.Helper()
+
+	var mu sync.Mutex
+	runs := map[int]int{}
+	migrations := counted(runs, &mu)
+
+	var wg sync.WaitGroup
+	applied := make([]int, len(conns))
+	errs := make([]error, len(conns))
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn *gorm.DB) {
+			defer wg.Done()
+			applied[i], errs[i] = Up(conn, migrations)
+		}(i, conn)
+	}
+	wg.Wait()
+
+	total := 0
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Up %d: %v", i, err)
+		}
+		total += applied[i]
+	}
+	if total != len(migrations) {
+		t.Errorf("applied %d migrations in total, want %d", total, len(migrations))
+	}
+	for _, m := range migrations {
+		if runs[m.Version] != 1 {
+			t.Errorf("migration %d ran %d times, want once", m.Version, runs[m.Version])
+		}
+	}
+
+	if current, err := Current(conns[0]); err != nil || current != len(migrations) {
+		t.Errorf("database is at version %d: %v", current, err)
+	}
+}
+
+func TestUpConcurrentlySQLite(t *testing.T) {
+	file := t.TempDir() + "/migrate.db"
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate", file)
+
+	var conns []*gorm.DB
+	for i := 0; i < 4; i++ {
+		conn, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+
+	// schema_version is created up front, two processes creating it at once is not what is tested
+	if _, err := Current(conns[0]); err != nil {
+		t.Fatal(err)
+	}
+	upConcurrently(t, conns)
+}
+
+// TestUpConcurrentlyPostgres needs an empty database, for example
+// TEST_POSTGRES_DSN="host=localhost user=postgres dbname=noti_test sslmode=disable"
+func TestUpConcurrentlyPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	var conns []*gorm.DB
+	for i := 0; i < 4; i++ {
+		conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	t.Cleanup(func() {
+		for version := 1; version <= 5; version++ {
+			conns[0].Exec(fmt.Sprintf("DROP TABLE IF EXISTS migrate_test_%d", version))
+		}
+		conns[0].Exec("DROP TABLE IF EXISTS schema_version")
+	})
+
+	upConcurrently(t, conns)
+}
@@ -1,145 +1,276 @@
 package notification
 
 import (
-	"encoding/json"
 	"fmt"
 	"go-noti-server/internal/log"
-	"os"
+	"go-noti-server/internal/migrate"
 	"strings"
 	"time"
 
-	"gorm.io/driver/sqlite"
+	"firebase.google.com/go/v4/messaging"
 	"gorm.io/gorm"
 )
 
-var db *gorm.DB
-
-func InitDB() (*gorm.DB, error) {
-	dbFile := "notifications.db"
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
-		file, err := os.Create(dbFile)
-		if err != nil {
-			log.ErrorLogger.Fatalf("Failed to create database file: %v", err)
-		}
-		file.Close()
-	}
+var (
+	store Store
+	db    *gorm.DB
+)
 
+// OpenDB connects to the configured database without looking at its schema
+func OpenDB(cfg StoreConfig) (*gorm.DB, error) {
 	var err error
-	db, err = gorm.Open(sqlite.Open(dbFile), &gorm.Config{})
+	store, db, err = openStore(cfg)
 	if err != nil {
-		log.ErrorLogger.Fatalf("Failed to connect to the database: %v", err)
-	}
-
-	// Clean up duplicates
-	err = db.Exec(`
-        DELETE FROM notifications
-        WHERE id NOT IN (
-            SELECT MIN(id)
-            FROM notifications
-            GROUP BY message, device_tokens
-        )
-    `).Error
-	if err != nil {
-		log.ErrorLogger.Fatalf("Failed to clean up duplicates: %v", err)
+		return nil, err
+	}
+	return db, nil
+}
+
+// InitDB opens the configured database and checks its schema against Migrations. Pending
+// migrations are applied when autoMigrate is set and are an error otherwise, except for manual
+// ones, which are logged and left to the migrate command; a database that is ahead of this
+// binary is always an error. A new database has no data for a manual step to rewrite, so it gets
+// every step at once.
+func InitDB(cfg StoreConfig, autoMigrate bool) (*gorm.DB, error) {
+	if _, err := OpenDB(cfg); err != nil {
+		return nil, fmt.Errorf("connecting to the database: %w", err)
 	}
 
-	err = db.AutoMigrate(&Notification{})
+	pending, err := migrate.Pending(db, Migrations)
 	if err != nil {
-		log.ErrorLogger.Fatalf("Failed to migrate database: %v", err)
+		return nil, err
+	}
+	empty := len(pending) == len(Migrations) && !db.Migrator().HasTable(&Notification{})
+
+	// Manual steps are left to the migrate command, and so is everything after the first of them
+	automatic := pending
+	for i, m := range pending {
+		if m.Manual && !empty {
+			automatic = pending[:i]
+			break
+		}
+	}
+	manual := pending[len(automatic):]
+	for _, m := range manual {
+		if !m.Manual {
+			return nil, fmt.Errorf("migration %d %s waits for a manual migration, run the migrate command", m.Version, m.Name)
+		}
+	}
+
+	if len(automatic) > 0 {
+		if !autoMigrate {
+			return nil, fmt.Errorf("database schema is %d migrations behind, run the migrate command", len(automatic))
+		}
+
+		applied, err := migrate.UpTo(db, Migrations, automatic[len(automatic)-1].Version)
+		if err != nil {
+			return nil, err
+		}
+		log.InfoLogger.Printf("Applied %d database migrations", applied)
+	}
+
+	for _, m := range manual {
+		log.InfoLogger.Printf("Migration %d %s is pending, apply it with the migrate command", m.Version, m.Name)
 	}
 	return db, nil
 }
 
+// CloseDB closes the database connection
+func CloseDB() error {
+	return store.Close()
+}
+
 type Notification struct {
 	gorm.Model
-	Message        string `gorm:"type:string;uniqueIndex:idx_message_tokens"`
+	Message        string `gorm:"type:string"`
 	Title          string `gorm:"type:string"`
 	Body           string `gorm:"type:string"`
 	Image          string `gorm:"type:string"`
-	DeviceTokens   string `gorm:"type:text;uniqueIndex:idx_message_tokens"`
 	AnalyticsLabel string `gorm:"type:text"`
 	Data           string `gorm:"type:text"`
+	Overrides      string `gorm:"type:text"`
 	Processed      bool   `gorm:"column:processed"`
 	Processing     bool   `gorm:"column:processing"`
-}
+	Status         Status `gorm:"type:string;index;default:queued"`
+	IdempotencyKey string `gorm:"type:string;index"`
+	Tenant         string `gorm:"type:string;index"`
+	Topic          string `gorm:"type:string"`
+	// Users whose registered devices are added as recipients when the notification is dispatched
+	UserIDs string `gorm:"type:text"`
+	// When the devices of UserIDs were added, they are only looked up once
+	ExpandedAt *time.Time `gorm:"column:expanded_at"`
+	Condition  string     `gorm:"type:text"`
 
-func SaveNotification(n Notification) error {
-	const maxRetries int = 10
+	// SendAt holds back a scheduled notification until that time, nil sends right away
+	SendAt *time.Time `gorm:"column:send_at;index"`
 
-	for i := 0; i < maxRetries; i++ {
-		err := db.Create(&n).Error
-		if err == nil {
-			return nil
-		}
+	// Audit trail of CancelNotification
+	CancelledAt  *time.Time `gorm:"column:cancelled_at"`
+	CancelReason string     `gorm:"type:text"`
+	CancelledBy  string     `gorm:"type:string"`
 
-		if strings.Contains(err.Error(), "database is locked") {
-			log.InfoLogger.Printf("Retrying to save notification: %v", err)
-			time.Sleep(time.Duration(i+1) * time.Second) // Exponential backoff
-			continue
-		}
+	// Retry bookkeeping, the targets still to be sent are the pending recipients
+	Attempts      int        `gorm:"column:attempts;default:0"`
+	NextAttemptAt *time.Time `gorm:"column:next_attempt_at;index"`
+	LastError     string     `gorm:"type:text"`
 
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			log.InfoLogger.Printf("Duplicate notification detected: %v", err)
-			return nil
-		}
+	// Set while a dispatcher holds the notification. An expired lease means its owner died.
+	LeaseOwner     string     `gorm:"column:lease_owner;index"`
+	LeaseExpiresAt *time.Time `gorm:"column:lease_expires_at"`
 
-		return err
+	// Device tokens to create recipients from when the notification is saved, not stored here
+	Tokens []string `gorm:"-"`
+}
+
+// Targets for topics and conditions are stored alongside device tokens with these prefixes
+const (
+	topicPrefix     = "topic:"
+	conditionPrefix = "condition:"
+)
+
+// targets returns the device tokens, topic and condition a new notification is addressed to, as
+// stored on its recipients
+func (n Notification) targets() []string {
+	targets := append([]string{}, n.Tokens...)
+	if n.Topic != "" {
+		targets = append(targets, topicPrefix+n.Topic)
+	}
+	if n.Condition != "" {
+		targets = append(targets, conditionPrefix+n.Condition)
 	}
+	return targets
+}
 
-	log.ErrorLogger.Errorf("Failed to save after %v tries", maxRetries)
+// isDeviceToken reports whether a target is a device token rather than a topic or condition
+func isDeviceToken(target string) bool {
+	return !strings.HasPrefix(target, topicPrefix) && !strings.HasPrefix(target, conditionPrefix)
+}
 
-	return fmt.Errorf("failed to save notification after %d retries", maxRetries)
+// setTarget addresses msg to a target as returned by Targets
+func setTarget(msg *messaging.Message, target string) {
+	switch {
+	case strings.HasPrefix(target, topicPrefix):
+		msg.Topic = strings.TrimPrefix(target, topicPrefix)
+	case strings.HasPrefix(target, conditionPrefix):
+		msg.Condition = strings.TrimPrefix(target, conditionPrefix)
+	default:
+		msg.Token = target
+	}
 }
 
-func FetchPendingNotifications() ([]Notification, error) {
-	var notifications []Notification
-	err := db.Where("processed = ?", false).Find(&notifications).Error
-	return notifications, err
+// SaveNotification stores a new notification and returns its ID. When the notification carries
+// an idempotency key that was used within the dedupe window, nothing is stored and the ID of the
+// original notification is returned with duplicate set.
+func SaveNotification(n Notification) (id uint, duplicate bool, err error) {
+	results, err := store.SaveNotifications([]Notification{n})
+	if err != nil {
+		return 0, false, err
+	}
+	return results[0].ID, results[0].Duplicate, nil
 }
 
-func FetchOnePendingNotification() (Notification, error) {
-	var notification Notification
+// SaveResult is the outcome of one notification of a batch
+type SaveResult struct {
+	ID        uint
+	Duplicate bool
+}
 
-	err := db.Model(&Notification{}).Where("processed = ?", false).First(&notification).Error
-	return notification, err
+// SaveNotifications stores a batch of notifications in a single transaction. Results line up
+// with notifications; either all of them are stored or none are.
+func SaveNotifications(notifications []Notification) ([]SaveResult, error) {
+	return store.SaveNotifications(notifications)
 }
 
-func MarkNotificationAsProcessed(id uint) error {
-	return db.Transaction(func(tx *gorm.DB) error {
-		if err := db.Model(&Notification{}).Where("id = ?", id).Update("processed", true).Error; err != nil {
-			return err
+func saveNotification(tx *gorm.DB, n *Notification) (uint, bool, error) {
+	if n.IdempotencyKey != "" {
+		original, found, err := lookupIdempotencyKey(tx, n.IdempotencyKey)
+		if err != nil || found {
+			return original, found, err
 		}
-		return nil
-	})
-}
+	}
 
-// CleanupOldNotifications deletes notifications older than a specified duration
-func CleanupOldNotifications(duration time.Duration) {
-	// Define the time threshold for deletion
-	threshold := time.Now().Add(-duration)
+	if err := tx.Create(n).Error; err != nil {
+		return 0, false, err
+	}
 
-	var notifications []Notification
-	// Delete old notifications
-	if err := db.Unscoped().Where("created_at < ?", threshold).Delete(&notifications).Error; err != nil {
-		log.InfoLogger.Printf("Error cleaning up old notifications: %v", err)
+	if err := addRecipients(tx, n.ID, n.targets()); err != nil {
+		return 0, false, err
 	}
 
-	if err := db.Exec("VACUUM").Error; err != nil {
-		log.InfoLogger.Printf("Error running VACUUM after cleanup: %v", err)
+	if n.IdempotencyKey != "" {
+		key := IdempotencyKey{Key: n.IdempotencyKey, NotificationID: n.ID}
+		if err := tx.Create(&key).Error; err != nil {
+			return 0, false, err
+		}
 	}
+
+	return n.ID, false, nil
 }
 
-func split(s, sep string) []string {
-	return strings.Split(s, sep)
+// MarkNotificationAsProcessed marks a notification as done after its final attempt. Recipients
+// still pending have failed. lastErr is the last FCM error seen on that attempt, if any.
+func MarkNotificationAsProcessed(id uint, attempts int, lastErr error) error {
+	return store.MarkNotificationAsProcessed(id, attempts, lastErr)
 }
 
-func parseData(data string) map[string]string {
-	var result map[string]string
-	err := json.Unmarshal([]byte(data), &result)
-	if err != nil {
-		log.InfoLogger.Printf("Error parsing data: %v", err)
-		return nil
+func (s *sqlStore) MarkNotificationAsProcessed(id uint, attempts int, lastErr error) error {
+	updates := map[string]interface{}{
+		"processed":        true,
+		"processing":       false,
+		"attempts":         attempts,
+		"lease_owner":      "",
+		"lease_expires_at": nil,
 	}
+	if lastErr != nil {
+		updates["last_error"] = lastErr.Error()
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var n Notification
+		if err := tx.Select("id", "status").First(&n, id).Error; err != nil {
+			return err
+		}
 
-	return result
+		// A notification cancelled mid-send keeps its status but is released all the same
+		if n.Status == StatusCancelled {
+			if err := settleRecipients(tx, id, RecipientCancelled); err != nil {
+				return err
+			}
+			return tx.Model(&Notification{}).Where("id = ?", id).Updates(updates).Error
+		}
+
+		if err := settleRecipients(tx, id, RecipientFailed); err != nil {
+			return err
+		}
+
+		status, err := finalStatus(tx, id)
+		if err != nil {
+			return err
+		}
+		updates["status"] = status
+
+		return tx.Model(&Notification{}).Where("id = ? AND status <> ?", id, StatusCancelled).Updates(updates).Error
+	})
+}
+
+// ScheduleRetry releases a notification back to the queue so that its pending recipients are
+// sent again once nextAttempt has passed
+func ScheduleRetry(id uint, attempts int, nextAttempt time.Time, lastError string) error {
+	return store.ScheduleRetry(id, attempts, nextAttempt, lastError)
+}
+
+func (s *sqlStore) ScheduleRetry(id uint, attempts int, nextAttempt time.Time, lastError string) error {
+	return s.db.Model(&Notification{}).Where("id = ? AND status <> ?", id, StatusCancelled).Updates(map[string]interface{}{
+		"processing":       false,
+		"status":           StatusQueued,
+		"attempts":         attempts,
+		"next_attempt_at":  nextAttempt,
+		"last_error":       lastError,
+		"lease_owner":      "",
+		"lease_expires_at": nil,
+	}).Error
+}
+
+func split(s, sep string) []string {
+	return strings.Split(s, sep)
 }
@@ -0,0 +1,287 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeadLetter keeps the payload of a notification whose tokens could not be delivered, because
+// they failed with an error a retry cannot fix or ran out of attempts, so it can be inspected and
+// replayed later. DeviceTokens, Topic and Condition are the targets that failed, ErrorCode is the
+// FCM error code every one of them failed with. Tenant is kept so that a notification recreated
+// by a replay still shows up in its tenant's delivery events.
+type DeadLetter struct {
+	gorm.Model
+	NotificationID       uint   `gorm:"index"`
+	Tenant               string `gorm:"type:string"`
+	Message              string `gorm:"type:string"`
+	Title                string `gorm:"type:string"`
+	Body                 string `gorm:"type:string"`
+	Image                string `gorm:"type:string"`
+	DeviceTokens         string `gorm:"type:text"`
+	Topic                string `gorm:"type:string"`
+	Condition            string `gorm:"type:text"`
+	AnalyticsLabel       string `gorm:"type:text"`
+	Data                 string `gorm:"type:text"`
+	Overrides            string `gorm:"type:text"`
+	Attempts             int    `gorm:"column:attempts"`
+	ErrorCode            string `gorm:"type:string"`
+	LastError            string `gorm:"type:text"`
+	History              string `gorm:"type:text"`
+	ReplayedAt           *time.Time
+	ReplayNotificationID uint
+}
+
+// DeadLetterAttempt summarises one attempt of a dead-lettered notification
+type DeadLetterAttempt struct {
+	Attempt      int       `json:"attempt"`
+	SentAt       time.Time `json:"sent_at"`
+	SuccessCount int       `json:"success_count"`
+	FailureCount int       `json:"failure_count"`
+	Error        string    `json:"error,omitempty"`
+}
+
+var (
+	// ErrDeadLetterReplayed is returned when replaying a dead letter that was already replayed
+	ErrDeadLetterReplayed = errors.New("dead letter already replayed")
+	// ErrNotificationInFlight is returned when replaying a dead letter whose notification is
+	// being sent; its worker would settle the replayed targets when it finishes
+	ErrNotificationInFlight = errors.New("notification is being sent")
+	// ErrNotificationCancelled is returned when replaying a dead letter whose notification was
+	// cancelled; whoever cancelled it did not want it sent
+	ErrNotificationCancelled = errors.New("notification was cancelled")
+)
+
+// AttemptHistory decodes the attempt history stored with the dead letter
+func (d DeadLetter) AttemptHistory() []DeadLetterAttempt {
+	var history []DeadLetterAttempt
+	if d.History == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(d.History), &history); err != nil {
+		return nil
+	}
+	return history
+}
+
+// SaveDeadLetter records the undelivered targets of a notification together with its payload, the
+// error code they failed with and the attempt history built from its deliveries
+func SaveDeadLetter(n Notification, targets []string, attempts int, errorCode string, lastErr error) error {
+	deliveries, err := FetchDeliveries(n.ID)
+	if err != nil {
+		return err
+	}
+
+	history, err := json.Marshal(attemptHistory(deliveries))
+	if err != nil {
+		return err
+	}
+
+	tokens, topic, condition := splitTargets(targets)
+
+	deadLetter := DeadLetter{
+		NotificationID: n.ID,
+		Tenant:         n.Tenant,
+		Message:        n.Message,
+		Title:          n.Title,
+		Body:           n.Body,
+		Image:          n.Image,
+		DeviceTokens:   strings.Join(tokens, ","),
+		Topic:          topic,
+		Condition:      condition,
+		AnalyticsLabel: n.AnalyticsLabel,
+		Data:           n.Data,
+		Overrides:      n.Overrides,
+		Attempts:       attempts,
+		ErrorCode:      errorCode,
+		History:        string(history),
+	}
+	if lastErr != nil {
+		deadLetter.LastError = lastErr.Error()
+	}
+
+	return store.CreateDeadLetter(&deadLetter)
+}
+
+// CreateDeadLetter stores a dead letter built by SaveDeadLetter
+func (s *sqlStore) CreateDeadLetter(deadLetter *DeadLetter) error {
+	return s.db.Create(deadLetter).Error
+}
+
+// targets returns the device tokens, topic and condition of a dead letter as recipient targets
+func (d DeadLetter) targets() []string {
+	n := Notification{Topic: d.Topic, Condition: d.Condition}
+	if d.DeviceTokens != "" {
+		n.Tokens = split(d.DeviceTokens, ",")
+	}
+	return n.targets()
+}
+
+func attemptHistory(deliveries []Delivery) []DeadLetterAttempt {
+	var history []DeadLetterAttempt
+	index := map[int]int{}
+
+	for _, d := range deliveries {
+		i, ok := index[d.Attempt]
+		if !ok {
+			i = len(history)
+			index[d.Attempt] = i
+			history = append(history, DeadLetterAttempt{Attempt: d.Attempt, SentAt: d.SentAt})
+		}
+
+		if d.Success {
+			history[i].SuccessCount++
+		} else {
+			history[i].FailureCount++
+			history[i].Error = d.Error
+		}
+	}
+	return history
+}
+
+// FetchDeadLetters lists dead letters, newest first, along with the total matching count
+func FetchDeadLetters(limit, offset int, includeReplayed bool) ([]DeadLetter, int64, error) {
+	query := db.Model(&DeadLetter{})
+	if !includeReplayed {
+		query = query.Where("replayed_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var deadLetters []DeadLetter
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&deadLetters).Error
+	return deadLetters, total, err
+}
+
+// FetchDeadLetter returns a single dead letter
+func FetchDeadLetter(id uint) (DeadLetter, error) {
+	var deadLetter DeadLetter
+	err := db.First(&deadLetter, id).Error
+	return deadLetter, err
+}
+
+// ReplayDeadLetter queues the undelivered tokens of a dead letter again. The original notification
+// is reset when it still exists, otherwise a new one is created from the stored payload. A
+// notification that is only waiting for a retry keeps its attempts and retry time, one that is
+// being sent is left alone and ErrNotificationInFlight is returned, and so is one that was
+// cancelled, with ErrNotificationCancelled. It returns the ID of the notification that was queued.
+func ReplayDeadLetter(id uint) (uint, error) {
+	return store.ReplayDeadLetter(id)
+}
+
+func (s *sqlStore) ReplayDeadLetter(id uint) (uint, error) {
+	var notificationID uint
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var deadLetter DeadLetter
+		if err := tx.First(&deadLetter, id).Error; err != nil {
+			return err
+		}
+		if deadLetter.ReplayedAt != nil {
+			return ErrDeadLetterReplayed
+		}
+
+		targets := deadLetter.targets()
+
+		var original Notification
+		err := tx.Select("id", "processed", "status").First(&original, deadLetter.NotificationID).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			n := Notification{
+				Tenant:         deadLetter.Tenant,
+				Message:        deadLetter.Message,
+				Title:          deadLetter.Title,
+				Body:           deadLetter.Body,
+				Image:          deadLetter.Image,
+				AnalyticsLabel: deadLetter.AnalyticsLabel,
+				Data:           deadLetter.Data,
+				Overrides:      deadLetter.Overrides,
+			}
+			if err := tx.Create(&n).Error; err != nil {
+				return err
+			}
+			if err := addRecipients(tx, n.ID, targets); err != nil {
+				return err
+			}
+			notificationID = n.ID
+		case err != nil:
+			return err
+		case original.Status == StatusCancelled:
+			return ErrNotificationCancelled
+		default:
+			updates := map[string]interface{}{"updated_at": time.Now()}
+			if original.Processed {
+				updates = map[string]interface{}{
+					"processed":        false,
+					"status":           StatusQueued,
+					"attempts":         0,
+					"next_attempt_at":  nil,
+					"last_error":       "",
+					"lease_owner":      "",
+					"lease_expires_at": nil,
+				}
+			}
+
+			result := tx.Model(&Notification{}).
+				Where("id = ? AND processed = ? AND processing = ?", original.ID, original.Processed, false).
+				Updates(updates)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrNotificationInFlight
+			}
+			notificationID = original.ID
+
+			err := tx.Model(&Recipient{}).
+				Where("notification_id = ? AND target IN ?", notificationID, targets).
+				Updates(map[string]interface{}{"status": RecipientPending, "attempts": 0}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		return tx.Model(&deadLetter).Updates(map[string]interface{}{
+			"replayed_at":            now,
+			"replay_notification_id": notificationID,
+		}).Error
+	})
+
+	return notificationID, err
+}
+
+// PurgeDeadLetters permanently deletes the given dead letters and any created before olderThan.
+// A zero olderThan is ignored.
+func PurgeDeadLetters(ids []uint, olderThan time.Time) (int64, error) {
+	return store.PurgeDeadLetters(ids, olderThan)
+}
+
+func (s *sqlStore) PurgeDeadLetters(ids []uint, olderThan time.Time) (int64, error) {
+	var purged int64
+
+	if len(ids) > 0 {
+		result := s.db.Unscoped().Where("id IN ?", ids).Delete(&DeadLetter{})
+		if result.Error != nil {
+			return purged, result.Error
+		}
+		purged += result.RowsAffected
+	}
+
+	if !olderThan.IsZero() {
+		result := s.db.Unscoped().Where("created_at < ?", olderThan).Delete(&DeadLetter{})
+		if result.Error != nil {
+			return purged, result.Error
+		}
+		purged += result.RowsAffected
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,138 @@
+package notification
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// claimWithDeadLetter saves a notification, claims it and dead-letters its token b
+func claimWithDeadLetter(t *testing.T) (Notification, DeadLetter) {
+	t.Helper()
+
+	if _, _, err := SaveNotification(Notification{Message: "m", Tokens: []string{"a", "b"}}); err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	claimed, err := ClaimNotifications("w1", 1, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimNotifications claimed %d: %v", len(claimed), err)
+	}
+	n := claimed[0]
+
+	db.Model(&Recipient{}).Where("notification_id = ? AND target = ?", n.ID, "b").Update("status", RecipientFailed)
+	if err := SaveDeadLetter(n, []string{"b"}, 1, "UNKNOWN", errors.New("rejected")); err != nil {
+		t.Fatalf("SaveDeadLetter: %v", err)
+	}
+
+	deadLetters, _, err := FetchDeadLetters(1, 0, false)
+	if err != nil || len(deadLetters) != 1 {
+		t.Fatalf("got %d dead letters: %v", len(deadLetters), err)
+	}
+	return n, deadLetters[0]
+}
+
+func TestReplayDeadLetterLeavesInFlightNotificationAlone(t *testing.T) {
+	openTestDB(t)
+	n, deadLetter := claimWithDeadLetter(t)
+
+	if _, err := ReplayDeadLetter(deadLetter.ID); !errors.Is(err, ErrNotificationInFlight) {
+		t.Fatalf("ReplayDeadLetter returned %v, want ErrNotificationInFlight", err)
+	}
+
+	var after Notification
+	db.First(&after, n.ID)
+	if !after.Processing || after.LeaseOwner != "w1" || after.LeaseExpiresAt == nil {
+		t.Errorf("lease was changed: processing=%v owner=%q expires=%v", after.Processing, after.LeaseOwner, after.LeaseExpiresAt)
+	}
+
+	targets, err := pendingTargets(n.ID)
+	if err != nil || len(targets) != 1 || targets[0] != "a" {
+		t.Errorf("got pending targets %v, want a: %v", targets, err)
+	}
+	if d, _ := FetchDeadLetter(deadLetter.ID); d.ReplayedAt != nil {
+		t.Error("dead letter was marked replayed")
+	}
+}
+
+func TestReplayDeadLetterRefusesCancelledNotification(t *testing.T) {
+	openTestDB(t)
+	n, deadLetter := claimWithDeadLetter(t)
+
+	if _, err := CancelNotification(n.ID, "sent by mistake", "ops"); err != nil {
+		t.Fatalf("CancelNotification: %v", err)
+	}
+	if _, err := ReplayDeadLetter(deadLetter.ID); !errors.Is(err, ErrNotificationCancelled) {
+		t.Fatalf("ReplayDeadLetter returned %v, want ErrNotificationCancelled", err)
+	}
+
+	var after Notification
+	db.First(&after, n.ID)
+	if !after.Processed || after.Status != StatusCancelled || after.CancelReason != "sent by mistake" {
+		t.Errorf("got processed=%v status %q reason %q, want it still cancelled", after.Processed, after.Status, after.CancelReason)
+	}
+	if targets, err := pendingTargets(n.ID); err != nil || len(targets) != 0 {
+		t.Errorf("got pending targets %v, want none: %v", targets, err)
+	}
+	if d, _ := FetchDeadLetter(deadLetter.ID); d.ReplayedAt != nil {
+		t.Error("dead letter was marked replayed")
+	}
+}
+
+func TestReplayDeadLetterKeepsRetrySchedule(t *testing.T) {
+	openTestDB(t)
+	n, deadLetter := claimWithDeadLetter(t)
+
+	nextAttempt := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := ScheduleRetry(n.ID, 2, nextAttempt, "unavailable"); err != nil {
+		t.Fatalf("ScheduleRetry: %v", err)
+	}
+
+	replayed, err := ReplayDeadLetter(deadLetter.ID)
+	if err != nil || replayed != n.ID {
+		t.Fatalf("ReplayDeadLetter returned %d: %v", replayed, err)
+	}
+
+	var after Notification
+	db.First(&after, n.ID)
+	if after.Attempts != 2 || after.NextAttemptAt == nil || !after.NextAttemptAt.Equal(nextAttempt) {
+		t.Errorf("got attempts %d and next attempt %v, want 2 and %v", after.Attempts, after.NextAttemptAt, nextAttempt)
+	}
+
+	targets, err := pendingTargets(n.ID)
+	if err != nil || len(targets) != 2 {
+		t.Errorf("got pending targets %v, want a and b: %v", targets, err)
+	}
+}
+
+func TestReplayDeadLetterOfDeletedNotificationKeepsTenant(t *testing.T) {
+	openTestDB(t)
+
+	if _, _, err := SaveNotification(Notification{Message: "m", Tenant: "acme", Tokens: []string{"a"}}); err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	claimed, err := ClaimNotifications("w1", 1, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimNotifications claimed %d: %v", len(claimed), err)
+	}
+	if err := SaveDeadLetter(claimed[0], []string{"a"}, 1, "UNKNOWN", errors.New("rejected")); err != nil {
+		t.Fatalf("SaveDeadLetter: %v", err)
+	}
+
+	// Cleanup deleted the notification before the replay
+	db.Unscoped().Delete(&Notification{}, claimed[0].ID)
+
+	deadLetters, _, err := FetchDeadLetters(1, 0, false)
+	if err != nil || len(deadLetters) != 1 {
+		t.Fatalf("got %d dead letters: %v", len(deadLetters), err)
+	}
+	replayed, err := ReplayDeadLetter(deadLetters[0].ID)
+	if err != nil || replayed == claimed[0].ID {
+		t.Fatalf("ReplayDeadLetter returned %d: %v", replayed, err)
+	}
+
+	var n Notification
+	db.First(&n, replayed)
+	if n.Tenant != "acme" {
+		t.Errorf("replayed notification has tenant %q, want acme", n.Tenant)
+	}
+}
@@ -0,0 +1,143 @@
+package notification
+
+import (
+	"errors"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+	"gorm.io/gorm"
+)
+
+// Delivery is the FCM outcome for a single device token of a notification
+type Delivery struct {
+	ID             uint      `gorm:"primarykey"`
+	NotificationID uint      `gorm:"index"`
+	Attempt        int       `gorm:"column:attempt"`
+	Token          string    `gorm:"type:text;index"`
+	MessageID      string    `gorm:"type:string"`
+	Success        bool      `gorm:"column:success"`
+	ErrorCode      string    `gorm:"type:string"`
+	Error          string    `gorm:"type:text"`
+	SentAt         time.Time `gorm:"index"`
+}
+
+// SaveDeliveries stores one Delivery per SendResponse. responses must be in the same order as tokens,
+// which is how SendEach returns them.
+func SaveDeliveries(notificationID uint, attempt int, tokens []string, responses []*messaging.SendResponse, sentAt time.Time) error {
+	if len(responses) == 0 {
+		return nil
+	}
+
+	deliveries := make([]Delivery, 0, len(responses))
+	for i, resp := range responses {
+		if i >= len(tokens) {
+			break
+		}
+
+		// Tokens skipped because of a cancellation were never sent
+		if errors.Is(resp.Error, ErrCancelled) {
+			continue
+		}
+
+		delivery := Delivery{
+			NotificationID: notificationID,
+			Attempt:        attempt,
+			Token:          tokens[i],
+			MessageID:      resp.MessageID,
+			Success:        resp.Success,
+			SentAt:         sentAt,
+		}
+		if resp.Error != nil {
+			delivery.ErrorCode = errorCode(resp.Error)
+			delivery.Error = resp.Error.Error()
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := store.CreateDeliveries(deliveries); err != nil {
+		return err
+	}
+
+	publishDeliveryUpdate()
+	return nil
+}
+
+// CreateDeliveries stores the deliveries built by SaveDeliveries
+func (s *sqlStore) CreateDeliveries(deliveries []Delivery) error {
+	return s.db.CreateInBatches(deliveries, 100).Error
+}
+
+// FetchDeliveries returns every recorded delivery of a notification
+func FetchDeliveries(notificationID uint) ([]Delivery, error) {
+	return fetchDeliveries(db, notificationID)
+}
+
+func fetchDeliveries(conn *gorm.DB, notificationID uint) ([]Delivery, error) {
+	var deliveries []Delivery
+	err := conn.Where("notification_id = ?", notificationID).Order("id").Find(&deliveries).Error
+	return deliveries, err
+}
+
+// FetchDeliveriesForRecipients returns every delivery of the given recipients, oldest first
+func FetchDeliveriesForRecipients(recipients []Recipient) ([]Delivery, error) {
+	var deliveries []Delivery
+	if len(recipients) == 0 {
+		return deliveries, nil
+	}
+
+	wanted := map[uint]map[string]bool{}
+	var ids []uint
+	var targets []string
+	for _, r := range recipients {
+		if wanted[r.NotificationID] == nil {
+			wanted[r.NotificationID] = map[string]bool{}
+			ids = append(ids, r.NotificationID)
+		}
+		if !wanted[r.NotificationID][r.Target] {
+			targets = append(targets, r.Target)
+		}
+		wanted[r.NotificationID][r.Target] = true
+	}
+
+	var found []Delivery
+	if err := db.Where("notification_id IN ? AND token IN ?", ids, targets).Order("id").Find(&found).Error; err != nil {
+		return nil, err
+	}
+
+	// The query matches every target on every notification, keep the pairs that were asked for
+	for _, d := range found {
+		if wanted[d.NotificationID][d.Token] {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+// errorCode maps an FCM send error to its messaging error code
+func errorCode(err error) string {
+	err = chunkCause(err)
+	switch {
+	case err == nil:
+		return ""
+	case messaging.IsUnregistered(err):
+		return "UNREGISTERED"
+	case messaging.IsInvalidArgument(err):
+		return "INVALID_ARGUMENT"
+	case messaging.IsSenderIDMismatch(err):
+		return "SENDER_ID_MISMATCH"
+	case messaging.IsQuotaExceeded(err):
+		return "QUOTA_EXCEEDED"
+	case messaging.IsUnavailable(err):
+		return "UNAVAILABLE"
+	case messaging.IsInternal(err):
+		return "INTERNAL"
+	case messaging.IsThirdPartyAuthError(err):
+		return "THIRD_PARTY_AUTH_ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -0,0 +1,151 @@
+package notification
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Device is a registered device of a user. Notifications addressed to user IDs are sent to the
+// tokens of their devices.
+type Device struct {
+	ID         uint      `gorm:"primarykey"`
+	UserID     string    `gorm:"type:string;index"`
+	Token      string    `gorm:"type:text;uniqueIndex"`
+	Platform   string    `gorm:"type:string"`
+	AppVersion string    `gorm:"type:string"`
+	Locale     string    `gorm:"type:string"`
+	Timezone   string    `gorm:"type:string"`
+	LastSeenAt time.Time `gorm:"column:last_seen_at"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// RegisterDevice adds a device, or replaces the details of the device with the same token. A
+// token that moves to another user is reassigned. The app registering a token means it is valid
+// again, so it is taken off the dead token registry.
+func RegisterDevice(d *Device) error {
+	return store.RegisterDevice(d)
+}
+
+func (s *sqlStore) RegisterDevice(d *Device) error {
+	if d.LastSeenAt.IsZero() {
+		d.LastSeenAt = time.Now()
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token = ?", d.Token).Delete(&TokenHealth{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "token"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "app_version", "locale", "timezone", "last_seen_at", "updated_at"}),
+		}).Create(d).Error
+	})
+}
+
+// UpdateDevice changes the details of an existing device, found by token. Empty fields are left
+// as they are.
+func UpdateDevice(d Device) (Device, error) {
+	return store.UpdateDevice(d)
+}
+
+func (s *sqlStore) UpdateDevice(d Device) (Device, error) {
+	var existing Device
+	if err := s.db.Where("token = ?", d.Token).First(&existing).Error; err != nil {
+		return Device{}, err
+	}
+
+	if d.LastSeenAt.IsZero() {
+		d.LastSeenAt = time.Now()
+	}
+
+	err := s.db.Model(&existing).Updates(Device{
+		UserID:     d.UserID,
+		Platform:   d.Platform,
+		AppVersion: d.AppVersion,
+		Locale:     d.Locale,
+		Timezone:   d.Timezone,
+		LastSeenAt: d.LastSeenAt,
+	}).Error
+	return existing, err
+}
+
+// RemoveDevices deletes the device with the given token, or every device of userID when token
+// is empty
+func RemoveDevices(userID, token string) (int64, error) {
+	return store.RemoveDevices(userID, token)
+}
+
+func (s *sqlStore) RemoveDevices(userID, token string) (int64, error) {
+	query := s.db.Model(&Device{})
+	switch {
+	case token != "" && userID != "":
+		query = query.Where("token = ? AND user_id = ?", token, userID)
+	case token != "":
+		query = query.Where("token = ?", token)
+	default:
+		query = query.Where("user_id = ?", userID)
+	}
+
+	result := query.Delete(&Device{})
+	return result.RowsAffected, result.Error
+}
+
+// FetchDevices returns the devices of a user
+func FetchDevices(userID string) ([]Device, error) {
+	var devices []Device
+	err := db.Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&devices).Error
+	return devices, err
+}
+
+// expandUserDevices adds the device tokens of the notification's users as recipients, so that
+// every later step treats them like tokens the caller passed. Tokens already present and tokens
+// FCM reported as unregistered are skipped. Devices whose token was reported invalid are kept by
+// RecordDeadTokens and are still sent to. The devices are looked up once, ExpandedAt records it,
+// so a retry or replay only sends to the devices the notification started with.
+func expandUserDevices(n Notification) error {
+	if n.UserIDs == "" || n.ExpandedAt != nil {
+		return nil
+	}
+
+	var tokens []string
+	err := inChunks(split(n.UserIDs, ","), func(userIDs []string) error {
+		var found []string
+		if err := db.Model(&Device{}).Where("user_id IN ?", userIDs).Pluck("token", &found).Error; err != nil {
+			return err
+		}
+		tokens = append(tokens, found...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	alive, _, err := filterDeadTokens(tokens, "UNREGISTERED")
+	if err != nil {
+		return err
+	}
+
+	return store.AddUserDevices(n.ID, alive)
+}
+
+// AddUserDevices adds the device tokens of a notification's users as recipients and records that
+// they were looked up
+func (s *sqlStore) AddUserDevices(id uint, tokens []string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := addRecipients(tx, id, tokens); err != nil {
+			return err
+		}
+		return tx.Model(&Notification{}).Where("id = ?", id).Update("expanded_at", time.Now()).Error
+	})
+}
+
+// removeDeadDevices drops registered devices whose token FCM reported as unregistered
+func removeDeadDevices(conn *gorm.DB, tokens []string) error {
+	return inChunks(tokens, func(chunk []string) error {
+		return conn.Where("token IN ?", chunk).Delete(&Device{}).Error
+	})
+}
@@ -0,0 +1,190 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+func deadToken(token, code string) TokenHealth {
+	now := time.Now()
+	return TokenHealth{Token: token, ErrorCode: code, FailureCount: 1, FirstFailedAt: now, LastFailedAt: now}
+}
+
+func TestRecordDeadTokensOnlyRemovesUnregisteredDevices(t *testing.T) {
+	openTestDB(t)
+
+	for _, token := range []string{"unregistered", "invalid"} {
+		if err := RegisterDevice(&Device{UserID: "u1", Token: token}); err != nil {
+			t.Fatalf("RegisterDevice: %v", err)
+		}
+	}
+
+	if err := RecordDeadTokens([]TokenHealth{deadToken("unregistered", "UNREGISTERED"), deadToken("invalid", "INVALID_ARGUMENT")}); err != nil {
+		t.Fatalf("RecordDeadTokens: %v", err)
+	}
+
+	devices, err := FetchDevices("u1")
+	if err != nil {
+		t.Fatalf("FetchDevices: %v", err)
+	}
+	if len(devices) != 1 || devices[0].Token != "invalid" {
+		t.Errorf("got devices %+v, want only the INVALID_ARGUMENT one", devices)
+	}
+
+	// The device that stays is still sent to
+	id, _, err := SaveNotification(Notification{Message: "m", UserIDs: "u1"})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	var n Notification
+	db.First(&n, id)
+	if err := expandUserDevices(n); err != nil {
+		t.Fatalf("expandUserDevices: %v", err)
+	}
+
+	targets, err := pendingTargets(id)
+	if err != nil || len(targets) != 1 || targets[0] != "invalid" {
+		t.Errorf("got targets %v, want the INVALID_ARGUMENT device: %v", targets, err)
+	}
+}
+
+func TestRegisterDeviceRevivesDeadToken(t *testing.T) {
+	openTestDB(t)
+
+	if err := RecordDeadTokens([]TokenHealth{deadToken("t1", "UNREGISTERED")}); err != nil {
+		t.Fatalf("RecordDeadTokens: %v", err)
+	}
+	if err := RegisterDevice(&Device{UserID: "u1", Token: "t1"}); err != nil {
+		t.Fatalf("RegisterDevice: %v", err)
+	}
+
+	_, dead, err := FilterDeadTokens([]string{"t1"})
+	if err != nil || len(dead) != 0 {
+		t.Fatalf("t1 is still dead after registering: %v %v", dead, err)
+	}
+
+	id, _, err := SaveNotification(Notification{Message: "m", UserIDs: "u1"})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	var n Notification
+	db.First(&n, id)
+	if err := expandUserDevices(n); err != nil {
+		t.Fatalf("expandUserDevices: %v", err)
+	}
+
+	targets, err := pendingTargets(id)
+	if err != nil || len(targets) != 1 || targets[0] != "t1" {
+		t.Errorf("got targets %v, want t1: %v", targets, err)
+	}
+}
+
+func TestRecordDeadTokensBeyondTheVariableLimit(t *testing.T) {
+	openTestDB(t)
+
+	// Enough rows that a single INSERT or IN list would go over SQLite's bound variable limit
+	const count = 5000
+	var entries []TokenHealth
+	var tokens []string
+	for i := 0; i < count; i++ {
+		token := fmt.Sprintf("token-%d", i)
+		tokens = append(tokens, token)
+		entries = append(entries, deadToken(token, "UNREGISTERED"))
+	}
+	if err := RegisterDevice(&Device{UserID: "u1", Token: tokens[count-1]}); err != nil {
+		t.Fatalf("RegisterDevice: %v", err)
+	}
+
+	if err := RecordDeadTokens(entries); err != nil {
+		t.Fatalf("RecordDeadTokens: %v", err)
+	}
+
+	_, dead, err := FilterDeadTokens(tokens)
+	if err != nil || len(dead) != count {
+		t.Errorf("got %d dead tokens, want %d: %v", len(dead), count, err)
+	}
+	if devices, err := FetchDevices("u1"); err != nil || len(devices) != 0 {
+		t.Errorf("got devices %+v, want the unregistered one removed: %v", devices, err)
+	}
+}
+
+// sentTokens returns a SendEach replacement that fails every message and records its token
+func sentTokens(tokens *[]string) func(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+	return func(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+		resp := &messaging.BatchResponse{}
+		for _, msg := range messages {
+			*tokens = append(*tokens, msg.Token)
+			resp.Responses = append(resp.Responses, &messaging.SendResponse{Error: errors.New("rejected by FCM")})
+		}
+		return resp, nil
+	}
+}
+
+func TestReplayDoesNotAddDevicesRegisteredLater(t *testing.T) {
+	openTestDB(t)
+
+	if err := RegisterDevice(&Device{UserID: "u1", Token: "dev1"}); err != nil {
+		t.Fatalf("RegisterDevice: %v", err)
+	}
+	if _, _, err := SaveNotification(Notification{Message: "m", UserIDs: "u1"}); err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+
+	var first []string
+	runWorker(t, sentTokens(&first))
+
+	deadLetters, _, err := FetchDeadLetters(1, 0, false)
+	if err != nil || len(deadLetters) != 1 {
+		t.Fatalf("got %d dead letters: %v", len(deadLetters), err)
+	}
+
+	if err := RegisterDevice(&Device{UserID: "u1", Token: "dev2"}); err != nil {
+		t.Fatalf("RegisterDevice: %v", err)
+	}
+	if _, err := ReplayDeadLetter(deadLetters[0].ID); err != nil {
+		t.Fatalf("ReplayDeadLetter: %v", err)
+	}
+
+	var replayed []string
+	runWorker(t, sentTokens(&replayed))
+
+	if strings.Join(first, ",") != "dev1" || strings.Join(replayed, ",") != "dev1" {
+		t.Errorf("sent to %v, then %v on replay, want dev1 both times", first, replayed)
+	}
+}
+
+func TestExpandUserDevicesBeyondTheVariableLimit(t *testing.T) {
+	openTestDB(t)
+
+	const count = 40000
+	userIDs := make([]string, count)
+	for i := range userIDs {
+		userIDs[i] = fmt.Sprintf("u%d", i)
+	}
+	for _, userID := range []string{userIDs[0], userIDs[count-1]} {
+		if err := RegisterDevice(&Device{UserID: userID, Token: "token-" + userID}); err != nil {
+			t.Fatalf("RegisterDevice: %v", err)
+		}
+	}
+
+	id, _, err := SaveNotification(Notification{Message: "m", UserIDs: strings.Join(userIDs, ",")})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	var n Notification
+	db.First(&n, id)
+	if err := expandUserDevices(n); err != nil {
+		t.Fatalf("expandUserDevices: %v", err)
+	}
+
+	targets, err := pendingTargets(id)
+	if err != nil || len(targets) != 2 {
+		t.Errorf("got targets %v, want the devices of the first and last user: %v", targets, err)
+	}
+}
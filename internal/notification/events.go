@@ -0,0 +1,227 @@
+package notification
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeliveryEvent is a delivery together with the notification fields events are filtered on and
+// the cursor that resumes the feed right after it
+type DeliveryEvent struct {
+	Delivery
+	AnalyticsLabel string
+	Tenant         string
+	Cursor         string `gorm:"-"`
+}
+
+// DeliveryEventFilter narrows the event feed, empty fields match everything
+type DeliveryEventFilter struct {
+	NotificationID uint
+	AnalyticsLabel string
+	Tenant         string
+}
+
+const (
+	// maxEventGaps caps how many missing delivery IDs a cursor waits for
+	maxEventGaps = 1000
+	// eventGapTimeout is how long a missing delivery ID is waited for. A transaction that has not
+	// committed by then is taken to have rolled back.
+	eventGapTimeout = time.Minute
+)
+
+// EventCursor is a position in the event feed. Delivery IDs are handed out when a delivery is
+// inserted, not when its transaction commits, so on Postgres a delivery can become visible after
+// ones with higher IDs. The cursor therefore remembers the IDs below After it has not seen yet
+// and keeps looking for them for eventGapTimeout.
+type EventCursor struct {
+	After   uint
+	Pending map[uint]time.Time
+}
+
+// ParseEventCursor reads a cursor written by EventCursor.String: the last delivery ID followed by
+// the missing IDs, as in "120" or "120:117,118"
+func ParseEventCursor(s string) (EventCursor, error) {
+	c := EventCursor{Pending: map[uint]time.Time{}}
+
+	after, pending, _ := strings.Cut(s, ":")
+	id, err := strconv.ParseUint(after, 10, 64)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor %q", s)
+	}
+	c.After = uint(id)
+
+	now := time.Now()
+	for _, p := range split(pending, ",") {
+		if p == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(p, 10, 64)
+		if err != nil || uint(id) >= c.After {
+			return c, fmt.Errorf("invalid cursor %q", s)
+		}
+		c.Pending[uint(id)] = now
+	}
+	return c, nil
+}
+
+func (c EventCursor) String() string {
+	if len(c.Pending) == 0 {
+		return strconv.FormatUint(uint64(c.After), 10)
+	}
+
+	pending := make([]string, 0, len(c.Pending))
+	for _, id := range c.pendingIDs() {
+		pending = append(pending, strconv.FormatUint(uint64(id), 10))
+	}
+	return strconv.FormatUint(uint64(c.After), 10) + ":" + strings.Join(pending, ",")
+}
+
+func (c EventCursor) pendingIDs() []uint {
+	ids := make([]uint, 0, len(c.Pending))
+	for id := range c.Pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// FetchDeliveryEvents returns the events after the cursor, looking at up to limit deliveries,
+// and moves the cursor past them. Deliveries that were missing from an earlier read and have
+// committed since come first. more is set when the limit was reached.
+func FetchDeliveryEvents(cursor *EventCursor, filter DeliveryEventFilter, limit int) (events []DeliveryEvent, more bool, err error) {
+	if cursor.Pending == nil {
+		cursor.Pending = map[uint]time.Time{}
+	}
+
+	now := time.Now()
+	for id, seen := range cursor.Pending {
+		if now.Sub(seen) > eventGapTimeout {
+			delete(cursor.Pending, id)
+		}
+	}
+
+	query := db.Model(&Delivery{}).Where("id > ?", cursor.After)
+	if len(cursor.Pending) > 0 {
+		query = db.Model(&Delivery{}).Where("id > ? OR id IN ?", cursor.After, cursor.pendingIDs())
+	}
+
+	var ids []uint
+	if err := query.Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return nil, false, err
+	}
+	if len(ids) == 0 {
+		return nil, false, nil
+	}
+
+	matched := map[uint]DeliveryEvent{}
+	found, err := fetchDeliveryEvents(ids, filter)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, e := range found {
+		matched[e.ID] = e
+	}
+
+	var late, fresh []uint
+	for _, id := range ids {
+		if id <= cursor.After {
+			late = append(late, id)
+		} else {
+			fresh = append(fresh, id)
+		}
+	}
+
+	// A cursor of 0, or one from before retention deleted the oldest deliveries, would otherwise
+	// wait on gaps that never fill. IDs below the oldest delivery left are gone for good.
+	if len(fresh) > 0 && fresh[0] > cursor.After+1 {
+		var oldest uint
+		if err := db.Model(&Delivery{}).Select("COALESCE(MIN(id), 0)").Scan(&oldest).Error; err != nil {
+			return nil, false, err
+		}
+		if oldest > cursor.After+1 {
+			cursor.After = oldest - 1
+		}
+	}
+
+	emit := func(id uint) {
+		if e, ok := matched[id]; ok {
+			e.Cursor = cursor.String()
+			events = append(events, e)
+		}
+	}
+
+	for _, id := range late {
+		delete(cursor.Pending, id)
+		emit(id)
+	}
+	for _, id := range fresh {
+		for gap := cursor.After + 1; gap < id && len(cursor.Pending) < maxEventGaps; gap++ {
+			cursor.Pending[gap] = now
+		}
+		cursor.After = id
+		emit(id)
+	}
+
+	return events, len(ids) == limit, nil
+}
+
+// fetchDeliveryEvents returns the deliveries with the given IDs that match the filter
+func fetchDeliveryEvents(ids []uint, filter DeliveryEventFilter) ([]DeliveryEvent, error) {
+	query := db.Table("deliveries").
+		Select("deliveries.*, notifications.analytics_label, notifications.tenant").
+		Joins("LEFT JOIN notifications ON notifications.id = deliveries.notification_id").
+		Where("deliveries.id IN ?", ids)
+
+	if filter.NotificationID != 0 {
+		query = query.Where("deliveries.notification_id = ?", filter.NotificationID)
+	}
+	if filter.AnalyticsLabel != "" {
+		query = query.Where("notifications.analytics_label = ?", filter.AnalyticsLabel)
+	}
+	if filter.Tenant != "" {
+		query = query.Where("notifications.tenant = ?", filter.Tenant)
+	}
+
+	var events []DeliveryEvent
+	err := query.Scan(&events).Error
+	return events, err
+}
+
+// LatestDeliveryCursor returns a cursor at the newest event
+func LatestDeliveryCursor() (EventCursor, error) {
+	var latest uint
+	err := db.Model(&Delivery{}).Select("COALESCE(MAX(id), 0)").Scan(&latest).Error
+	return EventCursor{After: latest, Pending: map[uint]time.Time{}}, err
+}
+
+// IsDeadToken reports whether the event is FCM rejecting the token itself
+func (e DeliveryEvent) IsDeadToken() bool {
+	if e.Success || !isDeviceToken(e.Token) {
+		return false
+	}
+	return e.ErrorCode == "UNREGISTERED" || (e.ErrorCode == "INVALID_ARGUMENT" && namesRegistrationToken(e.Error))
+}
+
+var deliveryUpdates = struct {
+	sync.Mutex
+	ch chan struct{}
+}{ch: make(chan struct{})}
+
+// DeliveryUpdates returns a channel that is closed the next time deliveries are saved. Fetch
+// the channel before reading events so that no update is missed in between.
+func DeliveryUpdates() <-chan struct{} {
+	deliveryUpdates.Lock()
+	defer deliveryUpdates.Unlock()
+	return deliveryUpdates.ch
+}
+
+func publishDeliveryUpdate() {
+	deliveryUpdates.Lock()
+	defer deliveryUpdates.Unlock()
+	close(deliveryUpdates.ch)
+	deliveryUpdates.ch = make(chan struct{})
+}
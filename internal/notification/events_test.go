@@ -0,0 +1,127 @@
+package notification
+
+import (
+	"testing"
+	"time"
+)
+
+func saveDelivery(t *testing.T, id uint, notificationID uint) {
+	t.Helper()
+	if err := db.Create(&Delivery{ID: id, NotificationID: notificationID, Token: "t", Success: true, SentAt: time.Now()}).Error; err != nil {
+		t.Fatalf("saving delivery %d: %v", id, err)
+	}
+}
+
+func eventIDs(events []DeliveryEvent) []uint {
+	var ids []uint
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestFetchDeliveryEventsPicksUpLateCommits(t *testing.T) {
+	openTestDB(t)
+
+	// Delivery 2 belongs to a transaction that commits after delivery 3
+	saveDelivery(t, 1, 1)
+	saveDelivery(t, 3, 1)
+
+	cursor := EventCursor{}
+	events, more, err := FetchDeliveryEvents(&cursor, DeliveryEventFilter{}, 10)
+	if err != nil || more {
+		t.Fatalf("FetchDeliveryEvents: more=%v err=%v", more, err)
+	}
+	if ids := eventIDs(events); len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Fatalf("got events %v, want 1 and 3", ids)
+	}
+	if got := events[1].Cursor; got != "3:2" {
+		t.Fatalf("got cursor %q, want 3:2", got)
+	}
+
+	// A client reconnecting with the last cursor still gets delivery 2
+	resumed, err := ParseEventCursor(events[1].Cursor)
+	if err != nil {
+		t.Fatalf("ParseEventCursor: %v", err)
+	}
+
+	saveDelivery(t, 2, 1)
+	saveDelivery(t, 4, 1)
+
+	events, _, err = FetchDeliveryEvents(&resumed, DeliveryEventFilter{}, 10)
+	if err != nil {
+		t.Fatalf("FetchDeliveryEvents: %v", err)
+	}
+	if ids := eventIDs(events); len(ids) != 2 || ids[0] != 2 || ids[1] != 4 {
+		t.Fatalf("got events %v, want 2 and 4", ids)
+	}
+	if resumed.String() != "4" {
+		t.Errorf("got cursor %q, want 4", resumed.String())
+	}
+}
+
+func TestFetchDeliveryEventsForgetsRolledBackIDs(t *testing.T) {
+	openTestDB(t)
+
+	saveDelivery(t, 1, 1)
+	saveDelivery(t, 3, 2)
+
+	// Delivery 3 does not match the filter but still closes the gap below it
+	cursor := EventCursor{}
+	events, _, err := FetchDeliveryEvents(&cursor, DeliveryEventFilter{NotificationID: 1}, 10)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("got %d events: %v", len(events), err)
+	}
+	if len(cursor.Pending) != 1 {
+		t.Fatalf("got pending %v, want 2", cursor.Pending)
+	}
+
+	cursor.Pending[2] = time.Now().Add(-2 * eventGapTimeout)
+	if _, _, err := FetchDeliveryEvents(&cursor, DeliveryEventFilter{NotificationID: 1}, 10); err != nil {
+		t.Fatalf("FetchDeliveryEvents: %v", err)
+	}
+	if cursor.String() != "3" {
+		t.Errorf("got cursor %q, want 3 once the gap timed out", cursor.String())
+	}
+}
+
+func TestFetchDeliveryEventsSkipsGapsBelowOldestDelivery(t *testing.T) {
+	openTestDB(t)
+
+	// Retention deleted everything before delivery 2000
+	saveDelivery(t, 2000, 1)
+	saveDelivery(t, 2002, 1)
+
+	for _, after := range []uint{0, 1500} {
+		cursor := EventCursor{After: after}
+		events, _, err := FetchDeliveryEvents(&cursor, DeliveryEventFilter{}, 10)
+		if err != nil {
+			t.Fatalf("FetchDeliveryEvents: %v", err)
+		}
+		if ids := eventIDs(events); len(ids) != 2 || ids[0] != 2000 || ids[1] != 2002 {
+			t.Fatalf("after %d: got events %v, want 2000 and 2002", after, ids)
+		}
+		if _, ok := cursor.Pending[2001]; len(cursor.Pending) != 1 || !ok {
+			t.Errorf("after %d: got pending %v, want only 2001", after, cursor.pendingIDs())
+		}
+	}
+}
+
+func TestParseEventCursor(t *testing.T) {
+	for _, s := range []string{"0", "120", "120:117,118"} {
+		c, err := ParseEventCursor(s)
+		if err != nil {
+			t.Errorf("ParseEventCursor(%q): %v", s, err)
+			continue
+		}
+		if c.String() != s {
+			t.Errorf("ParseEventCursor(%q).String() = %q", s, c.String())
+		}
+	}
+
+	for _, s := range []string{"", "abc", "120:121", "120:x"} {
+		if _, err := ParseEventCursor(s); err == nil {
+			t.Errorf("ParseEventCursor(%q) accepted an invalid cursor", s)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package notification
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey remembers which notification a client supplied key created, so that a retried
+// request within the dedupe window returns the original instead of queuing it twice
+type IdempotencyKey struct {
+	Key            string    `gorm:"column:idempotency_key;primarykey;type:string"`
+	NotificationID uint      `gorm:"column:notification_id"`
+	CreatedAt      time.Time `gorm:"index"`
+}
+
+var idempotencyWindow = 24 * time.Hour
+
+// SetIdempotencyWindow sets how long an idempotency key keeps deduplicating requests
+func SetIdempotencyWindow(d time.Duration) {
+	if d > 0 {
+		idempotencyWindow = d
+	}
+}
+
+// lookupIdempotencyKey returns the notification a live key points to. An expired key is removed
+// so it can be claimed again.
+func lookupIdempotencyKey(tx *gorm.DB, key string) (uint, bool, error) {
+	var existing IdempotencyKey
+	result := tx.Where("idempotency_key = ?", key).Limit(1).Find(&existing)
+	if result.Error != nil {
+		return 0, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, false, nil
+	}
+
+	if existing.CreatedAt.After(time.Now().Add(-idempotencyWindow)) {
+		return existing.NotificationID, true, nil
+	}
+
+	return 0, false, tx.Delete(&existing).Error
+}
+
+// CleanupExpiredIdempotencyKeys deletes keys that are past the dedupe window
+func CleanupExpiredIdempotencyKeys() (int64, error) {
+	return store.CleanupExpiredIdempotencyKeys()
+}
+
+func (s *sqlStore) CleanupExpiredIdempotencyKeys() (int64, error) {
+	result := s.db.Where("created_at < ?", time.Now().Add(-idempotencyWindow)).Delete(&IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
+
+// CountExpiredIdempotencyKeys counts the keys CleanupExpiredIdempotencyKeys would delete
+func CountExpiredIdempotencyKeys() (int64, error) {
+	var count int64
+	err := db.Model(&IdempotencyKey{}).Where("created_at < ?", time.Now().Add(-idempotencyWindow)).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,85 @@
+package notification
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeyReturnsTheOriginalWithinTheWindow(t *testing.T) {
+	db := openTestDB(t)
+
+	id, duplicate, err := SaveNotification(Notification{Message: "first", Tokens: []string{"a"}, IdempotencyKey: "k"})
+	if err != nil || duplicate {
+		t.Fatalf("SaveNotification returned duplicate=%v: %v", duplicate, err)
+	}
+
+	replayed, duplicate, err := SaveNotification(Notification{Message: "second", Tokens: []string{"b"}, IdempotencyKey: "k"})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	if replayed != id || !duplicate {
+		t.Errorf("replayed key returned %d with duplicate=%v, want %d with duplicate=true", replayed, duplicate, id)
+	}
+
+	var count int64
+	db.Model(&Notification{}).Count(&count)
+	if count != 1 {
+		t.Errorf("stored %d notifications, want 1", count)
+	}
+}
+
+func TestExpiredIdempotencyKeyIsReclaimed(t *testing.T) {
+	db := openTestDB(t)
+
+	id, _, err := SaveNotification(Notification{Message: "first", Tokens: []string{"a"}, IdempotencyKey: "k"})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	expired := time.Now().Add(-idempotencyWindow - time.Minute)
+	if err := db.Model(&IdempotencyKey{}).Where("idempotency_key = ?", "k").UpdateColumn("created_at", expired).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	reclaimed, duplicate, err := SaveNotification(Notification{Message: "second", Tokens: []string{"b"}, IdempotencyKey: "k"})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	if reclaimed == id || duplicate {
+		t.Errorf("expired key returned %d with duplicate=%v, want a new notification", reclaimed, duplicate)
+	}
+
+	var key IdempotencyKey
+	db.Where("idempotency_key = ?", "k").First(&key)
+	if key.NotificationID != reclaimed || !key.CreatedAt.After(expired) {
+		t.Errorf("key points to %d since %v, want %d since now", key.NotificationID, key.CreatedAt, reclaimed)
+	}
+}
+
+func TestDuplicateIdempotencyKeyWithinABatch(t *testing.T) {
+	db := openTestDB(t)
+
+	results, err := SaveNotifications([]Notification{
+		{Message: "m", Tokens: []string{"a"}, IdempotencyKey: "k"},
+		{Message: "m", Tokens: []string{"a"}, IdempotencyKey: "k"},
+		{Message: "m", Tokens: []string{"a"}},
+	})
+	if err != nil {
+		t.Fatalf("SaveNotifications: %v", err)
+	}
+
+	if results[0].Duplicate || results[2].Duplicate {
+		t.Errorf("first and unkeyed notifications were reported as duplicates: %+v", results)
+	}
+	if !results[1].Duplicate || results[1].ID != results[0].ID {
+		t.Errorf("second use of the key returned %+v, want a duplicate of %d", results[1], results[0].ID)
+	}
+	if results[2].ID == results[0].ID {
+		t.Errorf("unkeyed notification got the ID of the keyed one")
+	}
+
+	var count int64
+	db.Model(&Notification{}).Count(&count)
+	if count != 2 {
+		t.Errorf("stored %d notifications, want 2", count)
+	}
+}
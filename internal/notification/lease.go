@@ -0,0 +1,131 @@
+package notification
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ClaimNotifications atomically leases up to limit notifications that are due to owner until
+// the lease expires, and returns them
+func ClaimNotifications(owner string, limit int, lease time.Duration) ([]Notification, error) {
+	return store.ClaimNotifications(owner, limit, lease)
+}
+
+// RenewLeases extends every lease still held by owner
+func RenewLeases(owner string, lease time.Duration) (int64, error) {
+	return store.RenewLeases(owner, lease)
+}
+
+func (s *sqlStore) RenewLeases(owner string, lease time.Duration) (int64, error) {
+	result := s.db.Model(&Notification{}).
+		Where("lease_owner = ? AND processing = ? AND processed = ?", owner, true, false).
+		Update("lease_expires_at", time.Now().Add(lease))
+	return result.RowsAffected, result.Error
+}
+
+// ReleaseLease gives a claimed notification back to the queue without counting an attempt
+func ReleaseLease(id uint, owner string) error {
+	return store.ReleaseLease(id, owner)
+}
+
+func (s *sqlStore) ReleaseLease(id uint, owner string) error {
+	return s.db.Model(&Notification{}).
+		Where("id = ? AND lease_owner = ? AND processed = ?", id, owner, false).
+		Updates(map[string]interface{}{
+			"processing":       false,
+			"status":           StatusQueued,
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		}).Error
+}
+
+// ReleaseLeases gives every unfinished notification held by owner back to the queue
+func ReleaseLeases(owner string) (int64, error) {
+	return store.ReleaseLeases(owner)
+}
+
+func (s *sqlStore) ReleaseLeases(owner string) (int64, error) {
+	result := s.db.Model(&Notification{}).
+		Where("lease_owner = ? AND processed = ?", owner, false).
+		Updates(map[string]interface{}{
+			"processing":       false,
+			"status":           StatusQueued,
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// ReclaimExpiredLeases returns notifications whose lease ran out, or that were marked processing
+// before leases existed, to the queue, and returns how many it requeued. A notification cancelled
+// while it was being sent is already finished; when its worker died before releasing it, its lease
+// is cleared without queueing it again, so that retention can delete it.
+func ReclaimExpiredLeases() (int64, error) {
+	return store.ReclaimExpiredLeases()
+}
+
+func (s *sqlStore) ReclaimExpiredLeases() (int64, error) {
+	var reclaimed int64
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Model(&Notification{}).
+			Where("processing = ?", true).
+			Where("lease_expires_at IS NULL OR lease_expires_at < ?", time.Now()).
+			Session(&gorm.Session{})
+
+		result := expired.Where("processed = ?", false).Updates(map[string]interface{}{
+			"processing":       false,
+			"status":           StatusQueued,
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		reclaimed = result.RowsAffected
+
+		return expired.Where("processed = ?", true).Updates(map[string]interface{}{
+			"processing":       false,
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		}).Error
+	})
+	return reclaimed, err
+}
+
+// QueueDepth counts notifications waiting to be claimed: due are ready now, delayed are waiting
+// for a retry, scheduled are waiting for their send time, and leased are claimed by any dispatcher
+func QueueDepth() (due, delayed, scheduled, leased int64, err error) {
+	return store.QueueDepth()
+}
+
+func (s *sqlStore) QueueDepth() (due, delayed, scheduled, leased int64, err error) {
+	now := time.Now()
+	waiting := s.db.Model(&Notification{}).Where("processed = ? AND processing = ?", false, false).Session(&gorm.Session{})
+
+	if err = waiting.
+		Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+		Where("send_at IS NULL OR send_at <= ?", now).
+		Count(&due).Error; err != nil {
+		return
+	}
+
+	if err = waiting.
+		Where("next_attempt_at > ?", now).
+		Count(&delayed).Error; err != nil {
+		return
+	}
+
+	if err = waiting.
+		Where("send_at > ?", now).
+		Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+		Count(&scheduled).Error; err != nil {
+		return
+	}
+
+	err = s.db.Model(&Notification{}).
+		Where("processed = ? AND processing = ?", false, true).
+		Count(&leased).Error
+	return
+}
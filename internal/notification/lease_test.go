@@ -0,0 +1,141 @@
+package notification
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestClaimNotificationsNeverHandsOutARowTwice(t *testing.T) {
+	db := openTestDB(t)
+
+	saveTestNotifications(t, 200)
+	assertClaimedOnce(t, db, claimConcurrently(t, 8, 10), 200)
+}
+
+// setColumns changes columns of a notification without touching anything else
+func setColumns(t *testing.T, db *gorm.DB, id uint, columns map[string]interface{}) {
+	t.Helper()
+
+	if err := db.Model(&Notification{}).Where("id = ?", id).UpdateColumns(columns).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClaimNotificationsSkipsWhatIsNotDue(t *testing.T) {
+	db := openTestDB(t)
+
+	saveTestNotifications(t, 6)
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	setColumns(t, db, 2, map[string]interface{}{"send_at": future})
+	setColumns(t, db, 3, map[string]interface{}{"next_attempt_at": future})
+	setColumns(t, db, 4, map[string]interface{}{"processed": true, "status": StatusSent})
+	setColumns(t, db, 5, map[string]interface{}{"send_at": past, "next_attempt_at": past})
+	if claimed, err := ClaimNotifications("other", 1, time.Minute); err != nil || len(claimed) != 1 || claimed[0].ID != 1 {
+		t.Fatalf("ClaimNotifications claimed %+v: %v", claimed, err)
+	}
+
+	claimed, err := ClaimNotifications("w1", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNotifications: %v", err)
+	}
+
+	var ids []uint
+	for _, n := range claimed {
+		ids = append(ids, n.ID)
+		if n.LeaseOwner != "w1" || n.Status != StatusSending || n.LeaseExpiresAt == nil {
+			t.Errorf("notification %d was returned with owner %q, status %s and lease %v", n.ID, n.LeaseOwner, n.Status, n.LeaseExpiresAt)
+		}
+	}
+	// 1 is leased to another owner, 2 and 3 are not due yet and 4 has finished
+	if len(ids) != 2 || ids[0] != 5 || ids[1] != 6 {
+		t.Errorf("claimed %v, want [5 6]", ids)
+	}
+}
+
+func TestRenewAndReleaseLeases(t *testing.T) {
+	db := openTestDB(t)
+
+	saveTestNotifications(t, 3)
+	for _, owner := range []string{"w1", "w1", "w2"} {
+		if claimed, err := ClaimNotifications(owner, 1, time.Minute); err != nil || len(claimed) != 1 {
+			t.Fatalf("ClaimNotifications claimed %d: %v", len(claimed), err)
+		}
+	}
+
+	renewed, err := RenewLeases("w1", time.Hour)
+	if err != nil || renewed != 2 {
+		t.Fatalf("RenewLeases renewed %d: %v", renewed, err)
+	}
+	var other Notification
+	db.First(&other, 3)
+	if other.LeaseExpiresAt.After(time.Now().Add(30 * time.Minute)) {
+		t.Errorf("the lease of w2 was renewed too")
+	}
+
+	// Only the owner can release a lease
+	if err := ReleaseLease(1, "w2"); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+	var n Notification
+	db.First(&n, 1)
+	if !n.Processing || n.LeaseOwner != "w1" {
+		t.Errorf("w2 released the lease of w1")
+	}
+
+	released, err := ReleaseLeases("w1")
+	if err != nil || released != 2 {
+		t.Fatalf("ReleaseLeases released %d: %v", released, err)
+	}
+	claimed, err := ClaimNotifications("w3", 10, time.Minute)
+	if err != nil || len(claimed) != 2 {
+		t.Errorf("claimed %d released notifications: %v", len(claimed), err)
+	}
+}
+
+func TestReclaimExpiredLeases(t *testing.T) {
+	db := openTestDB(t)
+
+	saveTestNotifications(t, 4)
+	if claimed, err := ClaimNotifications("w1", 4, time.Minute); err != nil || len(claimed) != 4 {
+		t.Fatalf("ClaimNotifications claimed %d: %v", len(claimed), err)
+	}
+
+	// 1 keeps its live lease
+	setColumns(t, db, 2, map[string]interface{}{"lease_expires_at": time.Now().Add(-time.Second)})
+	// Marked processing before leases existed
+	setColumns(t, db, 3, map[string]interface{}{"lease_owner": "", "lease_expires_at": nil})
+	// Cancelled while it was being sent, and its worker died before releasing it
+	if _, err := CancelNotification(4, "", ""); err != nil {
+		t.Fatalf("CancelNotification: %v", err)
+	}
+	setColumns(t, db, 4, map[string]interface{}{"lease_expires_at": time.Now().Add(-time.Second)})
+
+	reclaimed, err := ReclaimExpiredLeases()
+	if err != nil || reclaimed != 2 {
+		t.Fatalf("ReclaimExpiredLeases reclaimed %d: %v", reclaimed, err)
+	}
+
+	want := map[uint]bool{1: true, 2: false, 3: false}
+	for id, processing := range want {
+		var n Notification
+		db.First(&n, id)
+		if n.Processing != processing {
+			t.Errorf("notification %d is processing=%v, want %v", id, n.Processing, processing)
+		}
+		if !processing && (n.Status != StatusQueued || n.LeaseOwner != "" || n.LeaseExpiresAt != nil) {
+			t.Errorf("reclaimed notification %d is %s with owner %q and lease %v", id, n.Status, n.LeaseOwner, n.LeaseExpiresAt)
+		}
+	}
+
+	// The cancelled notification is released but stays finished
+	var n Notification
+	db.First(&n, 4)
+	if n.Processing || !n.Processed || n.Status != StatusCancelled || n.LeaseOwner != "" || n.LeaseExpiresAt != nil {
+		t.Errorf("cancelled notification is processing=%v processed=%v, %s with owner %q and lease %v",
+			n.Processing, n.Processed, n.Status, n.LeaseOwner, n.LeaseExpiresAt)
+	}
+}
@@ -0,0 +1,430 @@
+package notification
+
+import (
+	"strings"
+	"time"
+
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/migrate"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Migrations are the schema steps of the notification database, oldest first. Steps must never
+// change once released; schema changes go into a new step with the next version. The models
+// below are snapshots of the tables at the version that introduced them, so later changes to
+// the live models do not alter what an old step does.
+var Migrations = []migrate.Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up: func(tx *gorm.DB) error {
+			// Databases created before versioned migrations already have this table and index,
+			// only a new database gets them here
+			if err := tx.AutoMigrate(&v1Notification{}); err != nil {
+				return err
+			}
+			return tx.Exec("CREATE INDEX IF NOT EXISTS idx_notification_processing ON notifications (processing)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v1Notification{})
+		},
+	},
+	{
+		Version: 2,
+		Name:    "drop_message_tokens_index",
+		Up: func(tx *gorm.DB) error {
+			// Deduplication is done with idempotency keys now, identical messages are legitimate
+			if tx.Migrator().HasIndex(&v1Notification{}, "idx_message_tokens") {
+				return tx.Migrator().DropIndex(&v1Notification{}, "idx_message_tokens")
+			}
+			return nil
+		},
+		// The index would reject legitimate notifications, it is not brought back
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+	{
+		Version: 3,
+		Name:    "notification_lifecycle",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&v3Notification{}); err != nil {
+				return err
+			}
+			// Rows written before statuses existed were defaulted to queued
+			return tx.Model(&v3Notification{}).Where("processed = ? AND status = ?", true, StatusQueued).Update("status", StatusSent).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, "notifications", v3NotificationIndexes, v3NotificationColumns)
+		},
+	},
+	{
+		Version: 4,
+		Name:    "delivery_tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v4Delivery{}, &v4DeadLetter{}, &v4TokenHealth{}, &v4IdempotencyKey{}, &v4Device{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v4Device{}, &v4IdempotencyKey{}, &v4TokenHealth{}, &v4DeadLetter{}, &v4Delivery{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "recipients",
+		Up:      migrateToRecipients,
+		Down:    migrateFromRecipients,
+	},
+	{
+		Version:       6,
+		Name:          "sqlite_incremental_vacuum",
+		Up:            enableIncrementalVacuum,
+		NoTransaction: true,
+		Manual:        true,
+		// Incremental vacuum only changes how freed pages are returned, it is kept
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+}
+
+// Columns and indexes version 3 adds to notifications
+var (
+	v3NotificationColumns = []string{
+		"overrides", "status", "idempotency_key", "tenant", "topic", "user_ids", "expanded_at", "condition",
+		"send_at", "cancelled_at", "cancel_reason", "cancelled_by", "attempts", "next_attempt_at", "last_error",
+		"lease_owner", "lease_expires_at",
+	}
+	v3NotificationIndexes = []string{
+		"idx_notifications_status", "idx_notifications_idempotency_key", "idx_notifications_tenant",
+		"idx_notifications_send_at", "idx_notifications_next_attempt_at", "idx_notifications_lease_owner",
+	}
+)
+
+// dropColumns drops columns of table with ALTER TABLE, after the indexes over them. Unlike the
+// table rebuild of Migrator().DropColumn on SQLite, this keeps the other indexes of the table.
+func dropColumns(tx *gorm.DB, table string, indexes, columns []string) error {
+	for _, index := range indexes {
+		if err := tx.Exec("DROP INDEX IF EXISTS ?", clause.Table{Name: index}).Error; err != nil {
+			return err
+		}
+	}
+	for _, column := range columns {
+		if err := tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: table}, clause.Column{Name: column}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateToRecipients moves the targets of notifications, stored as a comma-joined device_tokens
+// column, into recipients and drops the column. Notifications the baseline server processed were
+// sent; the rest are still pending.
+func migrateToRecipients(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&v5Recipient{}); err != nil {
+		return err
+	}
+
+	err := eachLegacyNotification(tx, func(n v5Notification) error {
+		return migrateLegacyTargets(tx, n)
+	})
+	if err != nil {
+		return err
+	}
+
+	return dropColumns(tx, "notifications", nil, []string{"device_tokens"})
+}
+
+// migrateLegacyTargets creates the recipients of a notification. The baseline server recorded no
+// deliveries, but a database migrated down and up again has them, and they decide the status of
+// the targets they cover.
+func migrateLegacyTargets(tx *gorm.DB, n v5Notification) error {
+	var tokens []string
+	if n.DeviceTokens != "" {
+		tokens = split(n.DeviceTokens, ",")
+	}
+	targets := Notification{Tokens: tokens, Topic: n.Topic, Condition: n.Condition}.targets()
+
+	var deliveries []v4Delivery
+	if err := tx.Where("notification_id = ?", n.ID).Order("id").Find(&deliveries).Error; err != nil {
+		return err
+	}
+	latest := map[string]v4Delivery{}
+	attempts := map[string]int{}
+	for _, d := range deliveries {
+		latest[d.Token] = d
+		attempts[d.Token]++
+	}
+
+	seen := map[string]bool{}
+	var recipients []v5Recipient
+	for _, target := range targets {
+		if target == "" || seen[target] {
+			continue
+		}
+		seen[target] = true
+
+		r := v5Recipient{NotificationID: n.ID, Target: target, Attempts: attempts[target]}
+		d, delivered := latest[target]
+
+		switch {
+		case delivered && d.Success:
+			r.Status = RecipientSent
+		case !n.Processed:
+			r.Status = RecipientPending
+		case delivered && (d.ErrorCode == "UNREGISTERED" || (d.ErrorCode == "INVALID_ARGUMENT" && namesRegistrationToken(d.Error))) && isDeviceToken(target):
+			r.Status = RecipientDead
+		case !delivered && n.Status == StatusCancelled:
+			r.Status = RecipientCancelled
+		case !delivered && n.Status == StatusSent:
+			// Sent by the baseline server, version 3 marked the notification sent
+			r.Status = RecipientSent
+		default:
+			r.Status = RecipientFailed
+		}
+		if delivered {
+			r.MessageID = d.MessageID
+			r.ErrorCode = d.ErrorCode
+			r.LastError = d.Error
+		}
+		recipients = append(recipients, r)
+	}
+
+	if len(recipients) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(recipients, 500).Error
+}
+
+// migrateFromRecipients writes the device tokens of the recipients back into device_tokens and
+// drops the recipients table. The status of each recipient is lost; migrating up again works it
+// out from the deliveries.
+func migrateFromRecipients(tx *gorm.DB) error {
+	if err := tx.Migrator().AddColumn(&v5Notification{}, "DeviceTokens"); err != nil {
+		return err
+	}
+
+	err := eachLegacyNotification(tx, func(n v5Notification) error {
+		var targets []string
+		if err := tx.Model(&v5Recipient{}).Where("notification_id = ?", n.ID).Order("id").Pluck("target", &targets).Error; err != nil {
+			return err
+		}
+
+		var tokens []string
+		for _, target := range targets {
+			if isDeviceToken(target) {
+				tokens = append(tokens, target)
+			}
+		}
+
+		return tx.Model(&v5Notification{}).Where("id = ?", n.ID).Update("device_tokens", strings.Join(tokens, ",")).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Migrator().DropTable(&v5Recipient{})
+}
+
+// enableIncrementalVacuum switches a SQLite database to incremental auto vacuum, so cleanup can
+// free pages a few at a time instead of running a full VACUUM. Switching needs one last VACUUM,
+// which rewrites the whole file and blocks writes until it is done, so the step is manual: the
+// server leaves it pending on an existing database and it is applied with the migrate command.
+// A new database is switched when the server creates it, while the VACUUM costs nothing. Other
+// engines are left alone.
+func enableIncrementalVacuum(conn *gorm.DB) error {
+	const incremental = 2
+
+	if conn.Dialector.Name() != "sqlite" {
+		return nil
+	}
+
+	var mode int
+	if err := conn.Raw("PRAGMA auto_vacuum").Scan(&mode).Error; err != nil {
+		return err
+	}
+	if mode == incremental {
+		return nil
+	}
+
+	log.InfoLogger.Printf("Switching SQLite to incremental vacuum, this rewrites the database once and blocks writes until it is done")
+	if err := conn.Exec("PRAGMA auto_vacuum = INCREMENTAL").Error; err != nil {
+		return err
+	}
+	return conn.Exec("VACUUM").Error
+}
+
+// eachLegacyNotification calls fn for every notification, including deleted ones, in batches
+func eachLegacyNotification(tx *gorm.DB, fn func(n v5Notification) error) error {
+	const batchSize = 500
+
+	var lastID uint
+	for {
+		var batch []v5Notification
+		if err := tx.Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+
+		for _, n := range batch {
+			if err := fn(n); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Tables as of version 1, the schema the server created before versioned migrations
+
+type v1Notification struct {
+	gorm.Model
+	Message        string `gorm:"type:string;uniqueIndex:idx_message_tokens"`
+	Title          string `gorm:"type:string"`
+	Body           string `gorm:"type:string"`
+	Image          string `gorm:"type:string"`
+	DeviceTokens   string `gorm:"type:text;uniqueIndex:idx_message_tokens"`
+	AnalyticsLabel string `gorm:"type:text"`
+	Data           string `gorm:"type:text"`
+	Processed      bool   `gorm:"column:processed"`
+	Processing     bool   `gorm:"column:processing"`
+}
+
+func (v1Notification) TableName() string { return "notifications" }
+
+// Tables as of version 3
+
+type v3Notification struct {
+	gorm.Model
+	Message        string     `gorm:"type:string"`
+	Title          string     `gorm:"type:string"`
+	Body           string     `gorm:"type:string"`
+	Image          string     `gorm:"type:string"`
+	AnalyticsLabel string     `gorm:"type:text"`
+	Data           string     `gorm:"type:text"`
+	Overrides      string     `gorm:"type:text"`
+	Processed      bool       `gorm:"column:processed"`
+	Processing     bool       `gorm:"column:processing"`
+	Status         Status     `gorm:"type:string;index;default:queued"`
+	IdempotencyKey string     `gorm:"type:string;index"`
+	Tenant         string     `gorm:"type:string;index"`
+	Topic          string     `gorm:"type:string"`
+	UserIDs        string     `gorm:"type:text"`
+	ExpandedAt     *time.Time `gorm:"column:expanded_at"`
+	Condition      string     `gorm:"type:text"`
+	SendAt         *time.Time `gorm:"column:send_at;index"`
+	CancelledAt    *time.Time `gorm:"column:cancelled_at"`
+	CancelReason   string     `gorm:"type:text"`
+	CancelledBy    string     `gorm:"type:string"`
+	Attempts       int        `gorm:"column:attempts;default:0"`
+	NextAttemptAt  *time.Time `gorm:"column:next_attempt_at;index"`
+	LastError      string     `gorm:"type:text"`
+	LeaseOwner     string     `gorm:"column:lease_owner;index"`
+	LeaseExpiresAt *time.Time `gorm:"column:lease_expires_at"`
+}
+
+func (v3Notification) TableName() string { return "notifications" }
+
+// Tables as of version 4
+
+type v4Delivery struct {
+	ID             uint      `gorm:"primarykey"`
+	NotificationID uint      `gorm:"index"`
+	Attempt        int       `gorm:"column:attempt"`
+	Token          string    `gorm:"type:text;index"`
+	MessageID      string    `gorm:"type:string"`
+	Success        bool      `gorm:"column:success"`
+	ErrorCode      string    `gorm:"type:string"`
+	Error          string    `gorm:"type:text"`
+	SentAt         time.Time `gorm:"index"`
+}
+
+func (v4Delivery) TableName() string { return "deliveries" }
+
+type v4DeadLetter struct {
+	gorm.Model
+	NotificationID       uint   `gorm:"index"`
+	Tenant               string `gorm:"type:string"`
+	Message              string `gorm:"type:string"`
+	Title                string `gorm:"type:string"`
+	Body                 string `gorm:"type:string"`
+	Image                string `gorm:"type:string"`
+	DeviceTokens         string `gorm:"type:text"`
+	Topic                string `gorm:"type:string"`
+	Condition            string `gorm:"type:text"`
+	AnalyticsLabel       string `gorm:"type:text"`
+	Data                 string `gorm:"type:text"`
+	Overrides            string `gorm:"type:text"`
+	Attempts             int    `gorm:"column:attempts"`
+	ErrorCode            string `gorm:"type:string"`
+	LastError            string `gorm:"type:text"`
+	History              string `gorm:"type:text"`
+	ReplayedAt           *time.Time
+	ReplayNotificationID uint
+}
+
+func (v4DeadLetter) TableName() string { return "dead_letters" }
+
+type v4TokenHealth struct {
+	ID             uint      `gorm:"primarykey"`
+	Token          string    `gorm:"type:text;uniqueIndex"`
+	ErrorCode      string    `gorm:"type:string"`
+	Error          string    `gorm:"type:text"`
+	FailureCount   int       `gorm:"column:failure_count"`
+	NotificationID uint      `gorm:"column:notification_id"`
+	FirstFailedAt  time.Time `gorm:"column:first_failed_at"`
+	LastFailedAt   time.Time `gorm:"column:last_failed_at;index"`
+}
+
+func (v4TokenHealth) TableName() string { return "token_health" }
+
+type v4IdempotencyKey struct {
+	Key            string    `gorm:"column:idempotency_key;primarykey;type:string"`
+	NotificationID uint      `gorm:"column:notification_id"`
+	CreatedAt      time.Time `gorm:"index"`
+}
+
+func (v4IdempotencyKey) TableName() string { return "idempotency_keys" }
+
+type v4Device struct {
+	ID         uint      `gorm:"primarykey"`
+	UserID     string    `gorm:"type:string;index"`
+	Token      string    `gorm:"type:text;uniqueIndex"`
+	Platform   string    `gorm:"type:string"`
+	AppVersion string    `gorm:"type:string"`
+	Locale     string    `gorm:"type:string"`
+	Timezone   string    `gorm:"type:string"`
+	LastSeenAt time.Time `gorm:"column:last_seen_at"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (v4Device) TableName() string { return "devices" }
+
+// Tables as of version 5
+
+// v5Notification is the part of notifications version 5 reads and writes, deleted rows included
+type v5Notification struct {
+	ID           uint
+	DeviceTokens string `gorm:"type:text"`
+	Topic        string
+	Condition    string
+	Processed    bool
+	Status       Status
+}
+
+func (v5Notification) TableName() string { return "notifications" }
+
+type v5Recipient struct {
+	ID             uint            `gorm:"primarykey"`
+	NotificationID uint            `gorm:"uniqueIndex:idx_recipient_target,priority:1"`
+	Target         string          `gorm:"type:text;uniqueIndex:idx_recipient_target,priority:2;index"`
+	Status         RecipientStatus `gorm:"type:string;index;default:pending"`
+	Attempts       int             `gorm:"column:attempts;default:0"`
+	MessageID      string          `gorm:"type:string"`
+	ErrorCode      string          `gorm:"type:string"`
+	LastError      string          `gorm:"type:text"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (v5Recipient) TableName() string { return "recipients" }
@@ -0,0 +1,243 @@
+package notification
+
+import (
+	"strings"
+	"testing"
+
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/migrate"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// openTestDB opens a new SQLite database in a temporary directory and migrates it
+func openTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	setupTestLoggers()
+
+	return openTestDBAt(t, t.TempDir()+"/notifications.db")
+}
+
+func openTestDBAt(t testing.TB, file string) *gorm.DB {
+	t.Helper()
+
+	db, err := InitDB(StoreConfig{DSN: file}, true)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { CloseDB() })
+	return db
+}
+
+func setupTestLoggers() {
+	log.InfoLogger = logrus.New()
+	log.ErrorLogger = logrus.New()
+	log.InfoLogger.SetLevel(logrus.WarnLevel)
+}
+
+func notificationIndexNames(t *testing.T, db *gorm.DB) map[string]bool {
+	t.Helper()
+
+	var names []string
+	err := db.Raw("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'notifications'").Scan(&names).Error
+	if err != nil {
+		t.Fatalf("listing indexes: %v", err)
+	}
+
+	indexes := map[string]bool{}
+	for _, name := range names {
+		indexes[name] = true
+	}
+	return indexes
+}
+
+func assertNotificationIndexes(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	indexes := notificationIndexNames(t, db)
+	want := append([]string{"idx_notification_processing", "idx_notifications_deleted_at"}, v3NotificationIndexes...)
+	for _, name := range want {
+		if !indexes[name] {
+			t.Errorf("index %s missing after migrating, have %v", name, indexes)
+		}
+	}
+}
+
+func TestMigrateUpKeepsNotificationIndexes(t *testing.T) {
+	db := openTestDB(t)
+	assertNotificationIndexes(t, db)
+}
+
+func TestMigrateDownAndUpAgain(t *testing.T) {
+	db := openTestDB(t)
+
+	id, _, err := SaveNotification(Notification{Message: "m", Tokens: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+
+	// Back to the baseline schema and forward again
+	current, err := migrate.Current(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := current - 1
+	reverted, err := migrate.Down(db, Migrations, steps)
+	if err != nil || reverted != steps {
+		t.Fatalf("Down reverted %d: %v", reverted, err)
+	}
+	if _, err := migrate.Up(db, Migrations); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	assertNotificationIndexes(t, db)
+
+	var targets []string
+	if err := db.Model(&Recipient{}).Where("notification_id = ? AND status = ?", id, RecipientPending).Order("id").Pluck("target", &targets).Error; err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(targets, ",") != "a,b" {
+		t.Errorf("got pending targets %v after migrating down and up", targets)
+	}
+}
+
+// baselineNotification is the notifications table as the server created it before versioned
+// migrations: tokens comma-joined, no status, and a unique index over message and tokens
+type baselineNotification struct {
+	gorm.Model
+	Message        string `gorm:"type:string;uniqueIndex:idx_message_tokens"`
+	Title          string `gorm:"type:string"`
+	Body           string `gorm:"type:string"`
+	Image          string `gorm:"type:string"`
+	DeviceTokens   string `gorm:"type:text;uniqueIndex:idx_message_tokens"`
+	AnalyticsLabel string `gorm:"type:text"`
+	Data           string `gorm:"type:text"`
+	Processed      bool   `gorm:"column:processed"`
+	Processing     bool   `gorm:"column:processing"`
+}
+
+func (baselineNotification) TableName() string { return "notifications" }
+
+func TestMigrateUpFromUnversionedDatabaseKeepsNotificationIndexes(t *testing.T) {
+	setupTestLoggers()
+	file := t.TempDir() + "/notifications.db"
+
+	// A database created by the server before versioned migrations existed
+	legacy, err := gorm.Open(sqlite.Open(file), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := legacy.AutoMigrate(&baselineNotification{}); err != nil {
+		t.Fatal(err)
+	}
+	legacyRows := []baselineNotification{
+		{Message: "m", DeviceTokens: "a,b", Processed: true},
+		{Message: "m", DeviceTokens: "c"},
+	}
+	if err := legacy.Create(&legacyRows).Error; err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := legacy.DB()
+	sqlDB.Close()
+
+	db := openTestDBAt(t, file)
+	assertNotificationIndexes(t, db)
+	if indexes := notificationIndexNames(t, db); indexes["idx_message_tokens"] {
+		t.Error("idx_message_tokens is still there after migrating")
+	}
+
+	want := []struct {
+		status     Status
+		recipients map[string]RecipientStatus
+	}{
+		// Sent before deliveries were recorded
+		{StatusSent, map[string]RecipientStatus{"a": RecipientSent, "b": RecipientSent}},
+		{StatusQueued, map[string]RecipientStatus{"c": RecipientPending}},
+	}
+	for i, w := range want {
+		id := legacyRows[i].ID
+
+		var n Notification
+		if err := db.First(&n, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if n.Status != w.status {
+			t.Errorf("notification %d is %s, want %s", id, n.Status, w.status)
+		}
+
+		var recipients []Recipient
+		if err := db.Where("notification_id = ?", id).Order("id").Find(&recipients).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(recipients) != len(w.recipients) {
+			t.Errorf("got %d recipients for notification %d, want %d", len(recipients), id, len(w.recipients))
+		}
+		for _, r := range recipients {
+			if r.Status != w.recipients[r.Target] {
+				t.Errorf("recipient %s of notification %d is %s, want %s", r.Target, id, r.Status, w.recipients[r.Target])
+			}
+		}
+	}
+}
+
+func autoVacuum(t *testing.T, db *gorm.DB) int {
+	t.Helper()
+
+	var mode int
+	if err := db.Raw("PRAGMA auto_vacuum").Scan(&mode).Error; err != nil {
+		t.Fatalf("reading auto_vacuum: %v", err)
+	}
+	return mode
+}
+
+func TestNewDatabaseStartsWithIncrementalVacuum(t *testing.T) {
+	db := openTestDB(t)
+
+	if mode := autoVacuum(t, db); mode != 2 {
+		t.Errorf("auto_vacuum is %d after creating the database, want 2 (incremental)", mode)
+	}
+	if pending, err := migrate.Pending(db, Migrations); err != nil || len(pending) != 0 {
+		t.Errorf("got pending migrations %+v: %v", pending, err)
+	}
+}
+
+func TestIncrementalVacuumIsAManualMigration(t *testing.T) {
+	setupTestLoggers()
+	file := t.TempDir() + "/notifications.db"
+
+	// A database created by the server before versioned migrations existed
+	legacy, err := gorm.Open(sqlite.Open(file), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := legacy.AutoMigrate(&baselineNotification{}); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := legacy.DB()
+	sqlDB.Close()
+
+	// Starting up applies everything but the manual step
+	db := openTestDBAt(t, file)
+	if mode := autoVacuum(t, db); mode != 0 {
+		t.Errorf("auto_vacuum is %d after starting up, want 0", mode)
+	}
+	pending, err := migrate.Pending(db, Migrations)
+	if err != nil || len(pending) != 1 || pending[0].Name != "sqlite_incremental_vacuum" {
+		t.Fatalf("got pending migrations %+v: %v", pending, err)
+	}
+
+	// Starting again without auto-migrate is fine while only the manual step is pending
+	CloseDB()
+	if db, err = InitDB(StoreConfig{DSN: file}, false); err != nil {
+		t.Fatalf("InitDB without auto-migrate: %v", err)
+	}
+
+	// The migrate command applies it
+	if applied, err := migrate.Up(db, Migrations); err != nil || applied != 1 {
+		t.Fatalf("Up applied %d: %v", applied, err)
+	}
+	if mode := autoVacuum(t, db); mode != 2 {
+		t.Errorf("auto_vacuum is %d after migrating, want 2 (incremental)", mode)
+	}
+}
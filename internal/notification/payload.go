@@ -0,0 +1,201 @@
+package notification
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"go-noti-server/internal/log"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+// PlatformOverrides holds the per-platform settings of a notification. It is stored as JSON in
+// Notification.Overrides; a nil block keeps the defaults for that platform.
+type PlatformOverrides struct {
+	Android *AndroidOverrides `json:"android,omitempty"`
+	APNS    *APNSOverrides    `json:"apns,omitempty"`
+	Webpush *WebpushOverrides `json:"webpush,omitempty"`
+}
+
+type AndroidOverrides struct {
+	Priority    string `json:"priority,omitempty"`
+	TTLSeconds  int64  `json:"ttlSeconds,omitempty"`
+	Sound       string `json:"sound,omitempty"`
+	Badge       *int   `json:"badge,omitempty"`
+	ClickAction string `json:"clickAction,omitempty"`
+	Tag         string `json:"tag,omitempty"`
+	Color       string `json:"color,omitempty"`
+	ChannelID   string `json:"channelId,omitempty"`
+}
+
+type APNSOverrides struct {
+	Priority         string `json:"priority,omitempty"`
+	TTLSeconds       int64  `json:"ttlSeconds,omitempty"`
+	Sound            string `json:"sound,omitempty"`
+	Badge            *int   `json:"badge,omitempty"`
+	Category         string `json:"category,omitempty"`
+	ThreadID         string `json:"threadId,omitempty"`
+	MutableContent   bool   `json:"mutableContent,omitempty"`
+	ContentAvailable bool   `json:"contentAvailable,omitempty"`
+}
+
+type WebpushOverrides struct {
+	Urgency    string `json:"urgency,omitempty"`
+	TTLSeconds int64  `json:"ttlSeconds,omitempty"`
+	Link       string `json:"link,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	Icon       string `json:"icon,omitempty"`
+	Badge      string `json:"badge,omitempty"`
+}
+
+// ParseOverrides decodes the overrides stored with a notification
+func ParseOverrides(overrides string) PlatformOverrides {
+	var result PlatformOverrides
+	if overrides == "" {
+		return result
+	}
+	if err := json.Unmarshal([]byte(overrides), &result); err != nil {
+		log.InfoLogger.Printf("Error parsing overrides: %v", err)
+	}
+	return result
+}
+
+// ParseData decodes the data stored with a notification
+func ParseData(data string) map[string]string {
+	var result map[string]string
+	if data == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		log.InfoLogger.Printf("Error parsing data: %v", err)
+		return nil
+	}
+	return result
+}
+
+// newMessage builds the FCM message of a notification, without a target
+func newMessage(n Notification, data map[string]string, overrides PlatformOverrides) *messaging.Message {
+	return &messaging.Message{
+		Android: androidConfig(n, data, overrides.Android),
+		APNS:    apnsConfig(n, data, overrides.APNS),
+		Webpush: webpushConfig(n, overrides.Webpush),
+		Notification: &messaging.Notification{
+			Title:    n.Title,
+			Body:     n.Body,
+			ImageURL: n.Image,
+		},
+		FCMOptions: &messaging.FCMOptions{
+			AnalyticsLabel: n.AnalyticsLabel,
+		},
+		Data: data,
+	}
+}
+
+func androidConfig(n Notification, data map[string]string, o *AndroidOverrides) *messaging.AndroidConfig {
+	if o == nil {
+		o = &AndroidOverrides{}
+	}
+
+	config := &messaging.AndroidConfig{
+		Priority: "high",
+		Notification: &messaging.AndroidNotification{
+			Title:             n.Title,
+			Body:              n.Body,
+			ImageURL:          n.Image,
+			ChannelID:         data["channelId"],
+			Sound:             o.Sound,
+			ClickAction:       o.ClickAction,
+			Tag:               o.Tag,
+			Color:             o.Color,
+			NotificationCount: o.Badge,
+		},
+		Data: data,
+	}
+
+	if o.Priority != "" {
+		config.Priority = o.Priority
+	}
+	if o.ChannelID != "" {
+		config.Notification.ChannelID = o.ChannelID
+	}
+	if o.TTLSeconds > 0 {
+		ttl := time.Duration(o.TTLSeconds) * time.Second
+		config.TTL = &ttl
+	}
+	return config
+}
+
+func apnsConfig(n Notification, data map[string]string, o *APNSOverrides) *messaging.APNSConfig {
+	if o == nil {
+		o = &APNSOverrides{}
+	}
+
+	config := &messaging.APNSConfig{
+		Headers: map[string]string{
+			"apns-priority": "10",
+		},
+		Payload: &messaging.APNSPayload{
+			Aps: &messaging.Aps{
+				Alert: &messaging.ApsAlert{
+					Title:       n.Title,
+					Body:        n.Body,
+					LaunchImage: n.Image,
+				},
+				Sound:            "default",
+				Badge:            o.Badge,
+				Category:         o.Category,
+				ThreadID:         o.ThreadID,
+				MutableContent:   o.MutableContent,
+				ContentAvailable: o.ContentAvailable,
+			},
+			CustomData: map[string]interface{}{
+				"image-url": n.Image, // Custom key to handle image URL in your app
+				"data":      data,
+			},
+		},
+	}
+
+	if o.Priority != "" {
+		config.Headers["apns-priority"] = o.Priority
+	}
+	if o.Sound != "" {
+		config.Payload.Aps.Sound = o.Sound
+	}
+	if o.TTLSeconds > 0 {
+		expiration := time.Now().Add(time.Duration(o.TTLSeconds) * time.Second)
+		config.Headers["apns-expiration"] = strconv.FormatInt(expiration.Unix(), 10)
+	}
+	return config
+}
+
+// webpushConfig is only set when the notification has web push overrides, FCM falls back to the
+// top-level notification otherwise
+func webpushConfig(n Notification, o *WebpushOverrides) *messaging.WebpushConfig {
+	if o == nil {
+		return nil
+	}
+
+	config := &messaging.WebpushConfig{
+		Headers: map[string]string{},
+		Notification: &messaging.WebpushNotification{
+			Title: n.Title,
+			Body:  n.Body,
+			Image: n.Image,
+			Icon:  o.Icon,
+			Badge: o.Badge,
+			Tag:   o.Tag,
+		},
+	}
+
+	if o.Urgency != "" {
+		config.Headers["Urgency"] = o.Urgency
+	}
+	if o.TTLSeconds > 0 {
+		config.Headers["TTL"] = strconv.FormatInt(o.TTLSeconds, 10)
+	}
+	if o.Link != "" {
+		config.FCMOptions = &messaging.WebpushFCMOptions{Link: o.Link}
+	}
+	return config
+}
@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+func intPtr(i int) *int { return &i }
+
+func TestAndroidConfig(t *testing.T) {
+	n := Notification{Title: "title", Body: "body", Image: "https://example.com/i.png"}
+	data := map[string]string{"channelId": "from-data"}
+	ttl := time.Hour
+
+	tests := []struct {
+		name      string
+		overrides *AndroidOverrides
+		check     func(c *messaging.AndroidConfig) bool
+	}{
+		{"defaults", nil, func(c *messaging.AndroidConfig) bool {
+			return c.Priority == "high" && c.TTL == nil && c.Notification.ChannelID == "from-data" &&
+				c.Notification.Title == "title" && c.Notification.Body == "body" && c.Notification.ImageURL == n.Image &&
+				c.Notification.NotificationCount == nil && reflect.DeepEqual(c.Data, data)
+		}},
+		{"priority", &AndroidOverrides{Priority: "normal"}, func(c *messaging.AndroidConfig) bool { return c.Priority == "normal" }},
+		{"ttl", &AndroidOverrides{TTLSeconds: 3600}, func(c *messaging.AndroidConfig) bool { return c.TTL != nil && *c.TTL == ttl }},
+		{"sound", &AndroidOverrides{Sound: "chime"}, func(c *messaging.AndroidConfig) bool { return c.Notification.Sound == "chime" }},
+		{"badge", &AndroidOverrides{Badge: intPtr(3)}, func(c *messaging.AndroidConfig) bool {
+			return c.Notification.NotificationCount != nil && *c.Notification.NotificationCount == 3
+		}},
+		{"click action", &AndroidOverrides{ClickAction: "OPEN"}, func(c *messaging.AndroidConfig) bool { return c.Notification.ClickAction == "OPEN" }},
+		{"tag", &AndroidOverrides{Tag: "t"}, func(c *messaging.AndroidConfig) bool { return c.Notification.Tag == "t" }},
+		{"color", &AndroidOverrides{Color: "#ff0000"}, func(c *messaging.AndroidConfig) bool { return c.Notification.Color == "#ff0000" }},
+		{"channel", &AndroidOverrides{ChannelID: "alerts"}, func(c *messaging.AndroidConfig) bool { return c.Notification.ChannelID == "alerts" }},
+	}
+	for _, tt := range tests {
+		if c := androidConfig(n, data, tt.overrides); !tt.check(c) {
+			t.Errorf("%s: got %+v with notification %+v", tt.name, c, c.Notification)
+		}
+	}
+}
+
+func TestAPNSConfig(t *testing.T) {
+	n := Notification{Title: "title", Body: "body", Image: "https://example.com/i.png"}
+	data := map[string]string{"k": "v"}
+
+	tests := []struct {
+		name      string
+		overrides *APNSOverrides
+		check     func(c *messaging.APNSConfig) bool
+	}{
+		{"defaults", nil, func(c *messaging.APNSConfig) bool {
+			aps := c.Payload.Aps
+			_, expires := c.Headers["apns-expiration"]
+			return c.Headers["apns-priority"] == "10" && !expires && aps.Sound == "default" && aps.Badge == nil &&
+				aps.Alert.Title == "title" && aps.Alert.Body == "body" && aps.Alert.LaunchImage == n.Image &&
+				!aps.MutableContent && !aps.ContentAvailable && reflect.DeepEqual(c.Payload.CustomData["data"], data)
+		}},
+		{"priority", &APNSOverrides{Priority: "5"}, func(c *messaging.APNSConfig) bool { return c.Headers["apns-priority"] == "5" }},
+		{"ttl", &APNSOverrides{TTLSeconds: 3600}, func(c *messaging.APNSConfig) bool {
+			expiration, err := strconv.ParseInt(c.Headers["apns-expiration"], 10, 64)
+			return err == nil && expiration >= time.Now().Add(59*time.Minute).Unix() && expiration <= time.Now().Add(time.Hour).Unix()
+		}},
+		{"sound", &APNSOverrides{Sound: "chime.caf"}, func(c *messaging.APNSConfig) bool { return c.Payload.Aps.Sound == "chime.caf" }},
+		{"badge", &APNSOverrides{Badge: intPtr(0)}, func(c *messaging.APNSConfig) bool {
+			return c.Payload.Aps.Badge != nil && *c.Payload.Aps.Badge == 0
+		}},
+		{"category", &APNSOverrides{Category: "REPLY"}, func(c *messaging.APNSConfig) bool { return c.Payload.Aps.Category == "REPLY" }},
+		{"thread", &APNSOverrides{ThreadID: "chat-1"}, func(c *messaging.APNSConfig) bool { return c.Payload.Aps.ThreadID == "chat-1" }},
+		{"mutable content", &APNSOverrides{MutableContent: true}, func(c *messaging.APNSConfig) bool { return c.Payload.Aps.MutableContent }},
+		{"content available", &APNSOverrides{ContentAvailable: true}, func(c *messaging.APNSConfig) bool { return c.Payload.Aps.ContentAvailable }},
+	}
+	for _, tt := range tests {
+		if c := apnsConfig(n, data, tt.overrides); !tt.check(c) {
+			t.Errorf("%s: got headers %v and aps %+v", tt.name, c.Headers, c.Payload.Aps)
+		}
+	}
+}
+
+func TestWebpushConfig(t *testing.T) {
+	n := Notification{Title: "title", Body: "body", Image: "https://example.com/i.png"}
+
+	if c := webpushConfig(n, nil); c != nil {
+		t.Errorf("got %+v without overrides, want nil so FCM uses the top-level notification", c)
+	}
+
+	tests := []struct {
+		name      string
+		overrides *WebpushOverrides
+		check     func(c *messaging.WebpushConfig) bool
+	}{
+		{"empty", &WebpushOverrides{}, func(c *messaging.WebpushConfig) bool {
+			return len(c.Headers) == 0 && c.FCMOptions == nil &&
+				c.Notification.Title == "title" && c.Notification.Body == "body" && c.Notification.Image == n.Image
+		}},
+		{"urgency", &WebpushOverrides{Urgency: "low"}, func(c *messaging.WebpushConfig) bool { return c.Headers["Urgency"] == "low" }},
+		{"ttl", &WebpushOverrides{TTLSeconds: 60}, func(c *messaging.WebpushConfig) bool { return c.Headers["TTL"] == "60" }},
+		{"link", &WebpushOverrides{Link: "https://example.com"}, func(c *messaging.WebpushConfig) bool {
+			return c.FCMOptions != nil && c.FCMOptions.Link == "https://example.com"
+		}},
+		{"tag", &WebpushOverrides{Tag: "t"}, func(c *messaging.WebpushConfig) bool { return c.Notification.Tag == "t" }},
+		{"icon", &WebpushOverrides{Icon: "/icon.png"}, func(c *messaging.WebpushConfig) bool { return c.Notification.Icon == "/icon.png" }},
+		{"badge", &WebpushOverrides{Badge: "/badge.png"}, func(c *messaging.WebpushConfig) bool { return c.Notification.Badge == "/badge.png" }},
+	}
+	for _, tt := range tests {
+		if c := webpushConfig(n, tt.overrides); c == nil || !tt.check(c) {
+			t.Errorf("%s: got %+v", tt.name, c)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Pool runs a resizable set of workers reading from the same channel
+type Pool struct {
+	in      <-chan Notification
+	maxSize int
+
+	mu      sync.Mutex
+	stops   []chan struct{}
+	nextID  int
+	running sync.WaitGroup
+}
+
+func NewPool(in <-chan Notification, maxSize int) *Pool {
+	return &Pool{in: in, maxSize: maxSize}
+}
+
+// Size returns the number of running workers
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
+
+// MaxSize returns the largest size the pool can be resized to
+func (p *Pool) MaxSize() int {
+	return p.maxSize
+}
+
+// Resize starts or stops workers until n are running. Stopped workers finish the notification
+// they are sending before exiting.
+func (p *Pool) Resize(n int) error {
+	if n < 0 || (p.maxSize > 0 && n > p.maxSize) {
+		return fmt.Errorf("pool size must be between 0 and %d", p.maxSize)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.stops) < n {
+		stop := make(chan struct{})
+		p.stops = append(p.stops, stop)
+		p.running.Add(1)
+
+		go func(id int) {
+			defer p.running.Done()
+			Worker(id, p.in, stop)
+		}(p.nextID)
+		p.nextID++
+	}
+
+	for len(p.stops) > n {
+		last := len(p.stops) - 1
+		close(p.stops[last])
+		p.stops = p.stops[:last]
+	}
+
+	return nil
+}
+
+// Shutdown stops every worker and waits for them to finish the notification they are sending.
+// Nothing must be sent on the channel any more. It returns the notifications left in the channel,
+// which no worker took, and ctx's error if some workers are still busy when ctx expires.
+func (p *Pool) Shutdown(ctx context.Context) ([]Notification, error) {
+	if err := p.Resize(0); err != nil {
+		return nil, err
+	}
+
+	// Stopped workers take nothing more from the channel, so what is in it now stays there
+	var buffered []Notification
+drain:
+	for {
+		select {
+		case n, ok := <-p.in:
+			if !ok {
+				break drain
+			}
+			buffered = append(buffered, n)
+		default:
+			break drain
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return buffered, nil
+	case <-ctx.Done():
+		return buffered, ctx.Err()
+	}
+}
@@ -0,0 +1,68 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+func TestPoolShutdownReturnsOnlyUntakenNotificationsWhenItTimesOut(t *testing.T) {
+	db := openTestDB(t)
+
+	saveTestNotifications(t, 3)
+	claimed, err := ClaimNotifications("w1", 3, time.Minute)
+	if err != nil || len(claimed) != 3 {
+		t.Fatalf("ClaimNotifications claimed %d: %v", len(claimed), err)
+	}
+
+	// The worker hangs in FCM on the first notification
+	sending := make(chan struct{})
+	unblock := make(chan struct{})
+	sender = &Sender{parallelism: 1, sendEach: func(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+		close(sending)
+		<-unblock
+		return sendAll(ctx, messages)
+	}}
+	t.Cleanup(func() { sender = nil })
+
+	notifications := make(chan Notification, len(claimed))
+	pool := NewPool(notifications, 1)
+	if err := pool.Resize(1); err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	for _, n := range claimed {
+		notifications <- n
+	}
+	<-sending
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	buffered, err := pool.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown returned %v, want the deadline error", err)
+	}
+	if len(buffered) != 2 || buffered[0].ID != claimed[1].ID || buffered[1].ID != claimed[2].ID {
+		t.Fatalf("Shutdown returned %+v, want the two notifications the worker did not take", buffered)
+	}
+	for _, n := range buffered {
+		if err := ReleaseLease(n.ID, "w1"); err != nil {
+			t.Fatalf("ReleaseLease: %v", err)
+		}
+	}
+
+	// The notification being sent keeps its lease, another process must not claim it
+	var inFlight Notification
+	db.First(&inFlight, claimed[0].ID)
+	if !inFlight.Processing || inFlight.LeaseOwner != "w1" {
+		t.Errorf("notification being sent is processing=%v with owner %q, want it still leased to w1", inFlight.Processing, inFlight.LeaseOwner)
+	}
+	if again, err := ClaimNotifications("w2", 3, time.Minute); err != nil || len(again) != 2 {
+		t.Errorf("another owner claimed %d notifications, want the 2 released: %v", len(again), err)
+	}
+
+	close(unblock)
+	pool.running.Wait()
+}
@@ -0,0 +1,39 @@
+package notification
+
+import (
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// postgresStore keeps notifications in PostgreSQL, which any number of replicas can share
+type postgresStore struct {
+	sqlStore
+}
+
+func openPostgres(dsn string) (*postgresStore, error) {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
+	}
+	return &postgresStore{sqlStore{db: db}}, nil
+}
+
+// SaveNotifications retries when a concurrent transaction, possibly on another replica, claimed
+// the same idempotency key
+func (s *postgresStore) SaveNotifications(notifications []Notification) ([]SaveResult, error) {
+	return s.save(notifications)
+}
+
+// ClaimNotifications picks due rows with SELECT ... FOR UPDATE SKIP LOCKED, so that replicas
+// claiming at the same time each get different notifications instead of waiting on each other
+func (s *postgresStore) ClaimNotifications(owner string, limit int, lease time.Duration) ([]Notification, error) {
+	return s.claim(owner, limit, lease, clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+}
+
+// Compact leaves reclaiming space to autovacuum
+func (s *postgresStore) Compact() error {
+	return nil
+}
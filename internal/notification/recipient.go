@@ -0,0 +1,241 @@
+package notification
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecipientStatus is where a single target of a notification is
+type RecipientStatus string
+
+const (
+	RecipientPending   RecipientStatus = "pending"
+	RecipientSent      RecipientStatus = "sent"
+	RecipientFailed    RecipientStatus = "failed"
+	RecipientDead      RecipientStatus = "dead"
+	RecipientCancelled RecipientStatus = "cancelled"
+)
+
+// Recipient is one target of a notification: a device token, or a topic or condition stored
+// with its prefix. Each target appears once per notification.
+type Recipient struct {
+	ID             uint            `gorm:"primarykey"`
+	NotificationID uint            `gorm:"uniqueIndex:idx_recipient_target,priority:1"`
+	Target         string          `gorm:"type:text;uniqueIndex:idx_recipient_target,priority:2;index"`
+	Status         RecipientStatus `gorm:"type:string;index;default:pending"`
+	Attempts       int             `gorm:"column:attempts;default:0"`
+	MessageID      string          `gorm:"type:string"`
+	ErrorCode      string          `gorm:"type:string"`
+	LastError      string          `gorm:"type:text"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// addRecipients adds pending recipients to a notification. Targets it already has are skipped.
+func addRecipients(tx *gorm.DB, notificationID uint, targets []string) error {
+	seen := map[string]bool{}
+	var recipients []Recipient
+	for _, target := range targets {
+		if target == "" || seen[target] {
+			continue
+		}
+		seen[target] = true
+		recipients = append(recipients, Recipient{NotificationID: notificationID, Target: target, Status: RecipientPending})
+	}
+
+	if len(recipients) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(recipients, 500).Error
+}
+
+// FetchRecipients returns every recipient of a notification
+func FetchRecipients(notificationID uint) ([]Recipient, error) {
+	return fetchRecipients(db, notificationID)
+}
+
+func fetchRecipients(conn *gorm.DB, notificationID uint) ([]Recipient, error) {
+	var recipients []Recipient
+	err := conn.Where("notification_id = ?", notificationID).Order("id").Find(&recipients).Error
+	return recipients, err
+}
+
+// FetchRecipientsForTargets returns the notifications any of the device tokens, topics or
+// conditions were addressed to, newest first. A notificationID other than 0 only looks at that
+// notification.
+func FetchRecipientsForTargets(targets []string, notificationID uint, limit int) ([]Recipient, error) {
+	var recipients []Recipient
+	if len(targets) == 0 {
+		return recipients, nil
+	}
+
+	query := db.Where("target IN ?", targets)
+	if notificationID != 0 {
+		query = query.Where("notification_id = ?", notificationID)
+	}
+	err := query.Order("id DESC").Limit(limit).Find(&recipients).Error
+	return recipients, err
+}
+
+// pendingTargets returns the targets of a notification that still have to be sent
+func pendingTargets(notificationID uint) ([]string, error) {
+	var targets []string
+	err := db.Model(&Recipient{}).
+		Where("notification_id = ? AND status = ?", notificationID, RecipientPending).
+		Order("id").
+		Pluck("target", &targets).Error
+	return targets, err
+}
+
+// countRecipients counts the recipients of a notification with the given status
+func countRecipients(notificationID uint, status RecipientStatus) (int64, error) {
+	var count int64
+	err := db.Model(&Recipient{}).Where("notification_id = ? AND status = ?", notificationID, status).Count(&count).Error
+	return count, err
+}
+
+// recipientOutcome is what an attempt does to the recipients it got a response for. Those with
+// the same outcome are updated together.
+type recipientOutcome struct {
+	status      RecipientStatus // empty leaves the status as it is
+	onlyPending bool            // false also overrides a cancellation
+}
+
+var (
+	// A send that went through before a cancellation took effect still counts
+	outcomeSent      = recipientOutcome{status: RecipientSent}
+	outcomeDead      = recipientOutcome{status: RecipientDead, onlyPending: true}
+	outcomeRetryable = recipientOutcome{onlyPending: true}
+	outcomeFailed    = recipientOutcome{status: RecipientFailed, onlyPending: true}
+)
+
+// recordRecipientOutcomes updates the recipients of an attempt from the FCM responses, which are
+// in the same order as targets. Targets that failed with a retryable error stay pending.
+func recordRecipientOutcomes(notificationID uint, targets []string, responses []*messaging.SendResponse) error {
+	return store.RecordRecipientOutcomes(notificationID, targets, responses)
+}
+
+func (s *sqlStore) RecordRecipientOutcomes(notificationID uint, targets []string, responses []*messaging.SendResponse) error {
+	groups := map[recipientOutcome][]string{}
+	messageIDs := map[string]string{}
+	errorCodes := map[string]string{}
+	lastErrors := map[string]string{}
+
+	for i, resp := range responses {
+		if i >= len(targets) || errors.Is(resp.Error, ErrCancelled) {
+			continue
+		}
+
+		target := targets[i]
+		var outcome recipientOutcome
+		switch {
+		case resp.Success:
+			outcome = outcomeSent
+		case isDeadToken(resp.Error) && isDeviceToken(target):
+			outcome = outcomeDead
+		case isRetryable(resp.Error):
+			outcome = outcomeRetryable
+		default:
+			outcome = outcomeFailed
+		}
+
+		groups[outcome] = append(groups[outcome], target)
+		messageIDs[target] = resp.MessageID
+		errorCodes[target] = errorCode(resp.Error)
+		if resp.Error != nil {
+			lastErrors[target] = resp.Error.Error()
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, outcome := range []recipientOutcome{outcomeSent, outcomeDead, outcomeRetryable, outcomeFailed} {
+			err := inChunks(groups[outcome], func(chunk []string) error {
+				query := tx.Model(&Recipient{}).Where("notification_id = ? AND target IN ?", notificationID, chunk)
+				if outcome.onlyPending {
+					query = query.Where("status = ?", RecipientPending)
+				}
+
+				updates := map[string]interface{}{
+					"attempts":   gorm.Expr("attempts + 1"),
+					"message_id": byTarget(chunk, messageIDs),
+					"error_code": byTarget(chunk, errorCodes),
+					"last_error": byTarget(chunk, lastErrors),
+				}
+				if outcome.status != "" {
+					updates["status"] = outcome.status
+				}
+				return query.Updates(updates).Error
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// byTarget is the value of a column for the targets of an UPDATE: the value itself when they
+// all share it, otherwise a CASE picking each target's
+func byTarget(targets []string, values map[string]string) interface{} {
+	shared := true
+	for _, target := range targets[1:] {
+		if values[target] != values[targets[0]] {
+			shared = false
+			break
+		}
+	}
+	if shared {
+		return values[targets[0]]
+	}
+
+	var sql strings.Builder
+	args := make([]interface{}, 0, 2*len(targets))
+	sql.WriteString("CASE target")
+	for _, target := range targets {
+		sql.WriteString(" WHEN ? THEN ?")
+		args = append(args, target, values[target])
+	}
+	sql.WriteString(" END")
+	return gorm.Expr(sql.String(), args...)
+}
+
+// settleRecipients closes the recipients still pending when a notification finishes: they failed,
+// or were cancelled along with the notification
+func settleRecipients(tx *gorm.DB, notificationID uint, status RecipientStatus) error {
+	return tx.Model(&Recipient{}).
+		Where("notification_id = ? AND status = ?", notificationID, RecipientPending).
+		Update("status", status).Error
+}
+
+// CancelRecipients stops the given targets of a notification that has not finished yet, the
+// rest of it is still sent. It returns how many targets were cancelled.
+func CancelRecipients(notificationID uint, targets []string) (int64, error) {
+	return store.CancelRecipients(notificationID, targets)
+}
+
+func (s *sqlStore) CancelRecipients(notificationID uint, targets []string) (int64, error) {
+	var cancelled int64
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var n Notification
+		if err := tx.Select("id", "processed").First(&n, notificationID).Error; err != nil {
+			return err
+		}
+		if n.Processed {
+			return ErrFinished
+		}
+
+		result := tx.Model(&Recipient{}).
+			Where("notification_id = ? AND target IN ? AND status = ?", notificationID, targets, RecipientPending).
+			Update("status", RecipientCancelled)
+		cancelled = result.RowsAffected
+		return result.Error
+	})
+
+	return cancelled, err
+}
@@ -0,0 +1,99 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+func TestRecipientHistoryForTargets(t *testing.T) {
+	openTestDB(t)
+
+	first, _, err := SaveNotification(Notification{Message: "m", Tokens: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	second, _, err := SaveNotification(Notification{Message: "m", Tokens: []string{"b"}})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+
+	now := time.Now()
+	db.Create(&[]Delivery{
+		{NotificationID: first, Attempt: 1, Token: "a", Success: true, SentAt: now},
+		{NotificationID: first, Attempt: 1, Token: "b", ErrorCode: "UNAVAILABLE", SentAt: now},
+		{NotificationID: first, Attempt: 2, Token: "b", Success: true, SentAt: now},
+		{NotificationID: second, Attempt: 1, Token: "b", Success: true, SentAt: now},
+	})
+
+	recipients, err := FetchRecipientsForTargets([]string{"b"}, first, 10)
+	if err != nil {
+		t.Fatalf("FetchRecipientsForTargets: %v", err)
+	}
+	if len(recipients) != 1 || recipients[0].NotificationID != first {
+		t.Fatalf("got recipients %+v, want b of notification %d", recipients, first)
+	}
+
+	deliveries, err := FetchDeliveriesForRecipients(recipients)
+	if err != nil {
+		t.Fatalf("FetchDeliveriesForRecipients: %v", err)
+	}
+	if len(deliveries) != 2 || deliveries[0].Attempt != 1 || deliveries[1].Attempt != 2 {
+		t.Errorf("got deliveries %+v, want both attempts at b of notification %d", deliveries, first)
+	}
+
+	recipients, err = FetchRecipientsForTargets([]string{"a", "b"}, 0, 10)
+	if err != nil || len(recipients) != 3 || recipients[0].NotificationID != second {
+		t.Errorf("got %d recipients, newest first %+v: %v", len(recipients), recipients, err)
+	}
+}
+
+func TestRecordRecipientOutcomesInChunks(t *testing.T) {
+	openTestDB(t)
+
+	targets := make([]string, maxInValues+3)
+	responses := make([]*messaging.SendResponse, len(targets))
+	for i := range targets {
+		targets[i] = fmt.Sprintf("t%d", i)
+		responses[i] = &messaging.SendResponse{Success: true, MessageID: "id-" + targets[i]}
+	}
+	failed, cancelled := len(targets)-2, len(targets)-1
+	responses[failed] = &messaging.SendResponse{Error: errors.New("rejected")}
+	responses[cancelled] = &messaging.SendResponse{Error: errors.New("rejected")}
+
+	id, _, err := SaveNotification(Notification{Message: "m", Tokens: targets})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	if _, err := CancelRecipients(id, []string{targets[cancelled]}); err != nil {
+		t.Fatalf("CancelRecipients: %v", err)
+	}
+
+	if err := recordRecipientOutcomes(id, targets, responses); err != nil {
+		t.Fatalf("recordRecipientOutcomes: %v", err)
+	}
+
+	recipients, err := FetchRecipients(id)
+	if err != nil || len(recipients) != len(targets) {
+		t.Fatalf("got %d recipients: %v", len(recipients), err)
+	}
+	for i, r := range recipients {
+		switch i {
+		case failed:
+			if r.Status != RecipientFailed || r.Attempts != 1 || r.LastError != "rejected" {
+				t.Errorf("%s is %s after %d attempts with %q, want failed after 1 with rejected", r.Target, r.Status, r.Attempts, r.LastError)
+			}
+		case cancelled:
+			if r.Status != RecipientCancelled || r.Attempts != 0 {
+				t.Errorf("%s is %s after %d attempts, want it left cancelled", r.Target, r.Status, r.Attempts)
+			}
+		default:
+			if r.Status != RecipientSent || r.Attempts != 1 || r.MessageID != "id-"+r.Target {
+				t.Errorf("%s is %s after %d attempts with message %q, want sent with its own message", r.Target, r.Status, r.Attempts, r.MessageID)
+			}
+		}
+	}
+}
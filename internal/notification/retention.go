@@ -0,0 +1,93 @@
+package notification
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CleanupCounts is how many rows a cleanup removes, or would remove
+type CleanupCounts struct {
+	Notifications   int64
+	Deliveries      int64
+	Recipients      int64
+	IdempotencyKeys int64
+}
+
+// expiredNotifications selects finished notifications with the given status that finished before
+// olderThan. Notifications that are queued, scheduled or being sent never match.
+func expiredNotifications(tx *gorm.DB, status Status, olderThan time.Time) *gorm.DB {
+	return tx.Unscoped().Model(&Notification{}).
+		Where("processed = ? AND processing = ?", true, false).
+		Where("status = ? AND updated_at < ?", status, olderThan)
+}
+
+// CountExpiredNotifications counts what DeleteExpiredNotifications would remove, without a limit
+func CountExpiredNotifications(status Status, olderThan time.Time) (CleanupCounts, error) {
+	var counts CleanupCounts
+
+	if err := expiredNotifications(db, status, olderThan).Count(&counts.Notifications).Error; err != nil {
+		return counts, err
+	}
+
+	ids := expiredNotifications(db, status, olderThan).Select("id")
+	if err := db.Model(&Delivery{}).Where("notification_id IN (?)", ids).Count(&counts.Deliveries).Error; err != nil {
+		return counts, err
+	}
+	if err := db.Model(&Recipient{}).Where("notification_id IN (?)", ids).Count(&counts.Recipients).Error; err != nil {
+		return counts, err
+	}
+	err := db.Model(&IdempotencyKey{}).Where("notification_id IN (?)", ids).Count(&counts.IdempotencyKeys).Error
+	return counts, err
+}
+
+// DeleteExpiredNotifications deletes up to limit finished notifications with the given status that
+// finished before olderThan, together with their deliveries, recipients and the idempotency keys
+// that point to them, in one transaction
+func DeleteExpiredNotifications(status Status, olderThan time.Time, limit int) (CleanupCounts, error) {
+	return store.DeleteExpiredNotifications(status, olderThan, limit)
+}
+
+func (s *sqlStore) DeleteExpiredNotifications(status Status, olderThan time.Time, limit int) (CleanupCounts, error) {
+	var counts CleanupCounts
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := expiredNotifications(tx, status, olderThan).Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		result := tx.Where("notification_id IN ?", ids).Delete(&Delivery{})
+		if result.Error != nil {
+			return result.Error
+		}
+		counts.Deliveries = result.RowsAffected
+
+		result = tx.Where("notification_id IN ?", ids).Delete(&Recipient{})
+		if result.Error != nil {
+			return result.Error
+		}
+		counts.Recipients = result.RowsAffected
+
+		// A key replayed after this would return a notification that no longer exists
+		result = tx.Where("notification_id IN ?", ids).Delete(&IdempotencyKey{})
+		if result.Error != nil {
+			return result.Error
+		}
+		counts.IdempotencyKeys = result.RowsAffected
+
+		result = tx.Unscoped().Where("id IN ?", ids).Delete(&Notification{})
+		counts.Notifications = result.RowsAffected
+		return result.Error
+	})
+	return counts, err
+}
+
+// CompactDB gives the space freed by deletes back to the file system where the database needs
+// to be told to
+func CompactDB() error {
+	return store.Compact()
+}
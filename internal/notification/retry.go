@@ -0,0 +1,99 @@
+package notification
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/v4/errorutils"
+	"firebase.google.com/go/v4/messaging"
+)
+
+// RetryPolicy controls how transient FCM failures are retried
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var retryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   30 * time.Second,
+	MaxDelay:    time.Hour,
+}
+
+// SetRetryPolicy replaces the retry policy used by the workers. Call it before starting them.
+func SetRetryPolicy(p RetryPolicy) {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = time.Second
+	}
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = p.BaseDelay
+	}
+	retryPolicy = p
+}
+
+// Backoff returns the delay before the given retry attempt (1-based): exponential growth from
+// BaseDelay capped at MaxDelay, with half of it jittered. A server supplied Retry-After wins if longer.
+func (p RetryPolicy) Backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := p.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		if d := p.BaseDelay << shift; d > 0 && d < p.MaxDelay {
+			delay = d
+		}
+	}
+
+	half := delay / 2
+	delay = half + time.Duration(rand.Int63n(int64(half)+1))
+
+	if retryAfter > delay {
+		return retryAfter
+	}
+	return delay
+}
+
+// isRetryable reports whether an FCM error is transient and worth sending again
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	err = chunkCause(err)
+	return messaging.IsUnavailable(err) ||
+		messaging.IsInternal(err) ||
+		messaging.IsQuotaExceeded(err) ||
+		errorutils.IsUnavailable(err) ||
+		errorutils.IsInternal(err) ||
+		errorutils.IsResourceExhausted(err) ||
+		errorutils.IsDeadlineExceeded(err)
+}
+
+// retryAfter extracts the Retry-After header FCM attaches to throttling and unavailable errors
+func retryAfter(err error) time.Duration {
+	resp := errorutils.HTTPResponse(chunkCause(err))
+	if resp == nil {
+		return 0
+	}
+	return parseRetryAfter(resp.Header.Get("Retry-After"))
+}
+
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package notification
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoffGrowsUpToMaxDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+
+	// Past 32 the shift is skipped, and the shifted delay overflows long before 100
+	for attempt := 1; attempt <= 100; attempt++ {
+		want := time.Duration(math.Min(float64(p.BaseDelay)*math.Pow(2, float64(attempt-1)), float64(p.MaxDelay)))
+		for i := 0; i < 20; i++ {
+			if got := p.Backoff(attempt, 0); got < want/2 || got > want {
+				t.Fatalf("Backoff(%d) = %v, want between %v and %v", attempt, got, want/2, want)
+			}
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Hour}
+
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		got := p.Backoff(3, 0)
+		if got < 2*time.Second || got > 4*time.Second {
+			t.Fatalf("Backoff(3) = %v, want between 2s and 4s", got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("Backoff(3) returned %v every time", seen)
+	}
+}
+
+func TestBackoffHonoursRetryAfter(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+
+	if got := p.Backoff(1, 10*time.Minute); got != 10*time.Minute {
+		t.Errorf("Backoff with a longer Retry-After = %v, want 10m", got)
+	}
+	if got := p.Backoff(1, time.Second); got < 15*time.Second || got > 30*time.Second {
+		t.Errorf("Backoff with a shorter Retry-After = %v, want between 15s and 30s", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter(" 120 "); got != 2*time.Minute {
+		t.Errorf("parseRetryAfter(seconds) = %v, want 2m", got)
+	}
+
+	// HTTP dates only have second precision
+	date := time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 2*time.Minute-2*time.Second || got > 2*time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, want about 2m", date, got)
+	}
+
+	for _, value := range []string{"", "soon", "1.5"} {
+		if got := parseRetryAfter(value); got != 0 {
+			t.Errorf("parseRetryAfter(%q) = %v, want 0", value, got)
+		}
+	}
+}
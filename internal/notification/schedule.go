@@ -0,0 +1,105 @@
+package notification
+
+import (
+	"errors"
+	"time"
+
+	"go-noti-server/internal/log"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotWaiting is returned when rescheduling a notification that has already been claimed,
+	// finished or cancelled
+	ErrNotWaiting = errors.New("notification is no longer waiting to be sent")
+
+	// ErrFinished is returned when cancelling a notification that has already finished
+	ErrFinished = errors.New("notification has already finished")
+
+	// ErrCancelled is reported for tokens that were not sent because the notification was cancelled
+	ErrCancelled = errors.New("notification cancelled")
+)
+
+// RescheduleNotification moves the send time of a notification that has not been claimed yet.
+// A nil sendAt sends it on the next poll.
+func RescheduleNotification(id uint, sendAt *time.Time) error {
+	return store.RescheduleNotification(id, sendAt)
+}
+
+func (s *sqlStore) RescheduleNotification(id uint, sendAt *time.Time) error {
+	result := s.db.Model(&Notification{}).
+		Where("id = ? AND processed = ? AND processing = ?", id, false, false).
+		Update("send_at", sendAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	return s.missingOr(id, ErrNotWaiting)
+}
+
+// CancelNotification stops a notification that has not finished yet, recording why and by whom.
+// A queued or scheduled notification is never claimed after this; one that is being sent stops
+// before its next chunk and is not retried. It reports whether the notification was in flight.
+func CancelNotification(id uint, reason, cancelledBy string) (bool, error) {
+	return store.CancelNotification(id, reason, cancelledBy)
+}
+
+func (s *sqlStore) CancelNotification(id uint, reason, cancelledBy string) (bool, error) {
+	var inFlight bool
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var n Notification
+		if err := tx.Select("id", "processed", "processing").First(&n, id).Error; err != nil {
+			return err
+		}
+		if n.Processed {
+			return ErrFinished
+		}
+		inFlight = n.Processing
+
+		result := tx.Model(&Notification{}).
+			Where("id = ? AND processed = ?", id, false).
+			Updates(map[string]interface{}{
+				"processed":     true,
+				"status":        StatusCancelled,
+				"cancelled_at":  time.Now(),
+				"cancel_reason": reason,
+				"cancelled_by":  cancelledBy,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrFinished
+		}
+		return settleRecipients(tx, id, RecipientCancelled)
+	})
+
+	return inFlight, err
+}
+
+// IsCancelled reports whether a notification has been cancelled
+func IsCancelled(id uint) bool {
+	return store.IsCancelled(id)
+}
+
+func (s *sqlStore) IsCancelled(id uint) bool {
+	var count int64
+	if err := s.db.Model(&Notification{}).Where("id = ? AND status = ?", id, StatusCancelled).Count(&count).Error; err != nil {
+		log.ErrorLogger.Printf("Failed to check cancellation of notification %d: %v", id, err)
+		return false
+	}
+	return count > 0
+}
+
+// missingOr returns gorm.ErrRecordNotFound if the notification does not exist, otherwise err
+func (s *sqlStore) missingOr(id uint, err error) error {
+	var n Notification
+	if lookupErr := s.db.Select("id").First(&n, id).Error; lookupErr != nil {
+		return lookupErr
+	}
+	return err
+}
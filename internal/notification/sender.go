@@ -0,0 +1,218 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go-noti-server/internal/log"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/messaging"
+	"google.golang.org/api/option"
+)
+
+// MaxBatchSize is the most messages FCM accepts in one SendEach call
+const MaxBatchSize = 500
+
+// SenderConfig configures the shared sender
+type SenderConfig struct {
+	CredentialsFile string
+	// How often the credentials file is checked for changes, 0 disables reloading
+	ReloadInterval time.Duration
+	// How many SendEach chunks of one notification may be in flight at once
+	Parallelism int
+}
+
+// Sender holds the Firebase messaging client shared by every worker. The client is created once
+// and only rebuilt when the credentials file changes.
+type Sender struct {
+	credentialsFile string
+	parallelism     int
+
+	mu      sync.RWMutex
+	client  *messaging.Client
+	modTime time.Time
+
+	// sendEach replaces the messaging client's SendEach when set, for tests
+	sendEach func(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error)
+}
+
+var sender *Sender
+
+// InitSender creates the shared sender and starts watching its credentials file for changes
+func InitSender(ctx context.Context, cfg SenderConfig) error {
+	if cfg.Parallelism < 1 {
+		cfg.Parallelism = 1
+	}
+
+	s := &Sender{credentialsFile: cfg.CredentialsFile, parallelism: cfg.Parallelism}
+	if err := s.reload(ctx); err != nil {
+		return err
+	}
+
+	sender = s
+
+	if cfg.ReloadInterval > 0 {
+		go s.watchCredentials(ctx, cfg.ReloadInterval)
+	}
+	return nil
+}
+
+// Client returns the current messaging client
+func (s *Sender) Client() *messaging.Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.client
+}
+
+// SendEach sends messages with the current messaging client
+func (s *Sender) SendEach(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+	if s.sendEach != nil {
+		return s.sendEach(ctx, messages)
+	}
+	return s.Client().SendEach(ctx, messages)
+}
+
+// ChunkError is the error reported on every message of a chunk that failed as a whole, without
+// FCM answering for the messages one by one
+type ChunkError struct {
+	Err error
+}
+
+func (e *ChunkError) Error() string { return e.Err.Error() }
+
+func (e *ChunkError) Unwrap() error { return e.Err }
+
+// chunkCause returns the error a chunk failed with, FCM error checks do not unwrap errors
+func chunkCause(err error) error {
+	var chunkErr *ChunkError
+	if errors.As(err, &chunkErr) {
+		return chunkErr.Err
+	}
+	return err
+}
+
+// SendEachChunked sends messages in chunks of at most MaxBatchSize with a bounded number of chunks
+// in flight. The returned responses line up with messages; when a whole chunk fails, its error is
+// reported on every message of that chunk as a ChunkError. cancelled is checked before each chunk,
+// and once it reports true the remaining messages are not sent and fail with ErrCancelled.
+func (s *Sender) SendEachChunked(ctx context.Context, messages []*messaging.Message, cancelled func() bool) *messaging.BatchResponse {
+	var (
+		responses = make([]*messaging.SendResponse, len(messages))
+		slots     = make(chan struct{}, s.parallelism)
+		wg        sync.WaitGroup
+	)
+
+	for start := 0; start < len(messages); start += MaxBatchSize {
+		end := start + MaxBatchSize
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		slots <- struct{}{}
+
+		if cancelled != nil && cancelled() {
+			<-slots
+			for i := start; i < len(messages); i++ {
+				responses[i] = &messaging.SendResponse{Error: ErrCancelled}
+			}
+			break
+		}
+
+		wg.Add(1)
+
+		go func(start, end int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			resp, err := s.SendEach(ctx, messages[start:end])
+			if err == nil && resp != nil && len(resp.Responses) == end-start {
+				copy(responses[start:end], resp.Responses)
+				return
+			}
+
+			if err == nil {
+				err = fmt.Errorf("unexpected SendEach response for %d messages", end-start)
+			}
+			log.ErrorLogger.Printf("Error sending FCM messages %d-%d: %+v", start, end-1, err)
+			for i := start; i < end; i++ {
+				responses[i] = &messaging.SendResponse{Error: &ChunkError{Err: err}}
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	batch := &messaging.BatchResponse{Responses: responses}
+	for _, resp := range responses {
+		if resp.Success {
+			batch.SuccessCount++
+		} else {
+			batch.FailureCount++
+		}
+	}
+	return batch
+}
+
+func (s *Sender) reload(ctx context.Context) error {
+	info, err := os.Stat(s.credentialsFile)
+	if err != nil {
+		return fmt.Errorf("stat credentials file: %w", err)
+	}
+
+	app, err := firebase.NewApp(ctx, nil, option.WithCredentialsFile(s.credentialsFile))
+	if err != nil {
+		return fmt.Errorf("firebase init: %w", err)
+	}
+
+	client, err := app.Messaging(ctx)
+	if err != nil {
+		return fmt.Errorf("fcm client: %w", err)
+	}
+
+	s.mu.Lock()
+	s.client = client
+	s.modTime = info.ModTime()
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Sender) watchCredentials(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(s.credentialsFile)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to stat credentials file: %v", err)
+			continue
+		}
+
+		s.mu.RLock()
+		changed := !info.ModTime().Equal(s.modTime)
+		s.mu.RUnlock()
+
+		if !changed {
+			continue
+		}
+
+		// A broken file keeps the previous client in service
+		if err := s.reload(ctx); err != nil {
+			log.ErrorLogger.Printf("Failed to reload Firebase credentials: %v", err)
+			continue
+		}
+		log.InfoLogger.Printf("Reloaded Firebase credentials from %s", s.credentialsFile)
+	}
+}
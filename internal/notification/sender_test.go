@@ -0,0 +1,83 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+func TestSendEachChunked(t *testing.T) {
+	setupTestLoggers()
+
+	const (
+		count       = 1201
+		parallelism = 2
+	)
+
+	var (
+		mu                    sync.Mutex
+		chunks                []int
+		inFlight, maxInFlight int
+	)
+	s := &Sender{parallelism: parallelism, sendEach: func(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+		mu.Lock()
+		chunks = append(chunks, len(messages))
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		// Long enough for the other chunks to pile up behind the parallelism limit
+		time.Sleep(20 * time.Millisecond)
+
+		resp := &messaging.BatchResponse{}
+		for _, msg := range messages {
+			resp.Responses = append(resp.Responses, &messaging.SendResponse{Success: true, MessageID: "id-" + msg.Token})
+			resp.SuccessCount++
+		}
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return resp, nil
+	}}
+
+	messages := make([]*messaging.Message, count)
+	for i := range messages {
+		messages[i] = &messaging.Message{Token: fmt.Sprintf("token-%d", i)}
+	}
+
+	batch := s.SendEachChunked(context.Background(), messages, nil)
+
+	if len(chunks) != 3 {
+		t.Errorf("got %d SendEach calls, want 3", len(chunks))
+	}
+	sent := 0
+	for _, size := range chunks {
+		if size > MaxBatchSize {
+			t.Errorf("got a chunk of %d messages, want at most %d", size, MaxBatchSize)
+		}
+		sent += size
+	}
+	if sent != count {
+		t.Errorf("sent %d messages, want %d", sent, count)
+	}
+	if maxInFlight > parallelism {
+		t.Errorf("%d chunks were in flight at once, want at most %d", maxInFlight, parallelism)
+	}
+
+	if batch.SuccessCount != count || batch.FailureCount != 0 || len(batch.Responses) != count {
+		t.Fatalf("got %d responses with %d successes and %d failures, want %d successes",
+			len(batch.Responses), batch.SuccessCount, batch.FailureCount, count)
+	}
+	for i, resp := range batch.Responses {
+		if want := fmt.Sprintf("id-token-%d", i); resp.MessageID != want {
+			t.Fatalf("response %d is for %s, want %s", i, resp.MessageID, want)
+		}
+	}
+}
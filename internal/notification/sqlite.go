@@ -0,0 +1,169 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// maxGroupCommit caps how many save requests share one transaction
+const maxGroupCommit = 256
+
+var errStoreClosed = errors.New("store is closed")
+
+// sqliteStore keeps notifications in a local SQLite file. SQLite allows a single writer, so only
+// one replica can run against it. The database runs in WAL mode so reads do not wait for writes,
+// and new notifications are saved by a single writer goroutine that commits the requests queued
+// behind it together.
+type sqliteStore struct {
+	sqlStore
+	writes chan writeRequest
+	closed chan struct{}
+	done   chan struct{}
+}
+
+// writeRequest is a SaveNotifications call waiting for the writer
+type writeRequest struct {
+	notifications []Notification
+	result        chan writeResult
+}
+
+type writeResult struct {
+	results []SaveResult
+	err     error
+}
+
+func openSQLite(dbFile string, busyTimeout time.Duration) (*sqliteStore, error) {
+	if dbFile == "" {
+		dbFile = "notifications.db"
+	}
+	if busyTimeout <= 0 {
+		busyTimeout = 5 * time.Second
+	}
+
+	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+		file, err := os.Create(dbFile)
+		if err != nil {
+			return nil, err
+		}
+		file.Close()
+	}
+
+	// Immediate transactions take the write lock up front, so a writer waits out busy_timeout
+	// instead of failing when it would have to upgrade a read lock
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", dbFile, busyTimeout.Milliseconds())
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sqliteStore{
+		sqlStore: sqlStore{db: db},
+		writes:   make(chan writeRequest),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.writer()
+	return s, nil
+}
+
+// SaveNotifications hands the notifications to the writer and waits until they are committed
+func (s *sqliteStore) SaveNotifications(notifications []Notification) ([]SaveResult, error) {
+	req := writeRequest{notifications: notifications, result: make(chan writeResult, 1)}
+
+	select {
+	case s.writes <- req:
+	case <-s.closed:
+		return nil, errStoreClosed
+	}
+
+	result := <-req.result
+	return result.results, result.err
+}
+
+// writer saves requests one transaction at a time. Requests that arrive while a transaction is
+// being committed are committed together in the next one.
+func (s *sqliteStore) writer() {
+	defer close(s.done)
+
+	for {
+		var req writeRequest
+		select {
+		case req = <-s.writes:
+		case <-s.closed:
+			return
+		}
+
+		group := []writeRequest{req}
+	collect:
+		for len(group) < maxGroupCommit {
+			select {
+			case req := <-s.writes:
+				group = append(group, req)
+			default:
+				break collect
+			}
+		}
+
+		s.commit(group)
+	}
+}
+
+// commit saves a group of requests in one transaction. Each request runs in its own savepoint,
+// so one that fails is rolled back and reported without affecting the others.
+func (s *sqliteStore) commit(group []writeRequest) {
+	results := make([]writeResult, len(group))
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for i, req := range group {
+			results[i] = writeResult{results: make([]SaveResult, len(req.notifications))}
+
+			results[i].err = tx.Transaction(func(tx *gorm.DB) error {
+				for j := range req.notifications {
+					n := req.notifications[j]
+					n.ID = 0
+					id, duplicate, err := saveNotification(tx, &n)
+					if err != nil {
+						return err
+					}
+					results[i].results[j] = SaveResult{ID: id, Duplicate: duplicate}
+				}
+				return nil
+			})
+			if results[i].err != nil {
+				results[i].results = nil
+			}
+		}
+		return nil
+	})
+
+	for i, req := range group {
+		if err != nil {
+			results[i] = writeResult{err: err}
+		}
+		req.result <- results[i]
+	}
+}
+
+// ClaimNotifications needs no locking, SQLite runs the UPDATE with its subquery as one write
+func (s *sqliteStore) ClaimNotifications(owner string, limit int, lease time.Duration) ([]Notification, error) {
+	return s.claim(owner, limit, lease, nil)
+}
+
+// Compact frees the pages left empty by deletes, a few at a time instead of rewriting the whole
+// file like VACUUM does
+func (s *sqliteStore) Compact() error {
+	return s.db.Exec("PRAGMA incremental_vacuum").Error
+}
+
+// Close stops the writer once its current transaction is committed and closes the database
+func (s *sqliteStore) Close() error {
+	close(s.closed)
+	<-s.done
+	return s.sqlStore.Close()
+}
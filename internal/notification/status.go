@@ -0,0 +1,122 @@
+package notification
+
+import "gorm.io/gorm"
+
+// Status is where a notification is in its lifecycle
+type Status string
+
+const (
+	StatusQueued          Status = "queued"
+	StatusSending         Status = "sending"
+	StatusSent            Status = "sent"
+	StatusPartiallyFailed Status = "partially_failed"
+	StatusFailed          Status = "failed"
+	StatusCancelled       Status = "cancelled"
+)
+
+// TokenOutcome is a recipient of a notification with its latest delivery, or nil Delivery when
+// it has not been sent yet
+type TokenOutcome struct {
+	Token    string
+	Status   RecipientStatus
+	Delivery *Delivery
+}
+
+// StatusSummary describes a notification and what happened to each of its tokens
+type StatusSummary struct {
+	Notification Notification
+	Succeeded    int
+	Failed       int
+	Pending      int
+	Cancelled    int
+	ErrorCodes   map[string]int
+	Tokens       []TokenOutcome
+}
+
+// FetchNotificationStatus loads a notification along with the outcome of each recipient
+func FetchNotificationStatus(id uint) (StatusSummary, error) {
+	return store.FetchNotificationStatus(id)
+}
+
+func (s *sqlStore) FetchNotificationStatus(id uint) (StatusSummary, error) {
+	var n Notification
+	if err := s.db.First(&n, id).Error; err != nil {
+		return StatusSummary{}, err
+	}
+
+	recipients, err := fetchRecipients(s.db, id)
+	if err != nil {
+		return StatusSummary{}, err
+	}
+
+	deliveries, err := fetchDeliveries(s.db, id)
+	if err != nil {
+		return StatusSummary{}, err
+	}
+
+	latest := map[string]*Delivery{}
+	for i := range deliveries {
+		latest[deliveries[i].Token] = &deliveries[i]
+	}
+
+	summary := StatusSummary{Notification: n, ErrorCodes: map[string]int{}}
+	for _, r := range recipients {
+		summary.Tokens = append(summary.Tokens, TokenOutcome{Token: r.Target, Status: r.Status, Delivery: latest[r.Target]})
+
+		switch r.Status {
+		case RecipientPending:
+			summary.Pending++
+		case RecipientSent:
+			summary.Succeeded++
+		case RecipientCancelled:
+			summary.Cancelled++
+		default:
+			summary.Failed++
+			if r.ErrorCode != "" {
+				summary.ErrorCodes[r.ErrorCode]++
+			}
+		}
+	}
+	return summary, nil
+}
+
+// finalStatus works out how a finished notification went from the status of its recipients.
+// Recipients cancelled on their own count neither way; when every recipient was cancelled, so is
+// the notification.
+func finalStatus(tx *gorm.DB, id uint) (Status, error) {
+	var counts []struct {
+		Status RecipientStatus
+		Count  int
+	}
+	err := tx.Model(&Recipient{}).
+		Select("status, COUNT(*) AS count").
+		Where("notification_id = ?", id).
+		Group("status").
+		Scan(&counts).Error
+	if err != nil {
+		return "", err
+	}
+
+	var succeeded, unsent, cancelled int
+	for _, c := range counts {
+		switch c.Status {
+		case RecipientSent:
+			succeeded += c.Count
+		case RecipientCancelled:
+			cancelled += c.Count
+		default:
+			unsent += c.Count
+		}
+	}
+
+	switch {
+	case succeeded == 0 && unsent == 0 && cancelled > 0:
+		return StatusCancelled, nil
+	case succeeded == 0:
+		return StatusFailed, nil
+	case unsent > 0:
+		return StatusPartiallyFailed, nil
+	default:
+		return StatusSent, nil
+	}
+}
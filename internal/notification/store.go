@@ -0,0 +1,165 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go-noti-server/internal/log"
+
+	"firebase.google.com/go/v4/messaging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store is a database backend for notifications and every write of the service goes through it.
+// Engines override what they need to do differently, the rest comes from sqlStore.
+type Store interface {
+	SaveNotifications(notifications []Notification) ([]SaveResult, error)
+	ClaimNotifications(owner string, limit int, lease time.Duration) ([]Notification, error)
+	RenewLeases(owner string, lease time.Duration) (int64, error)
+	ReleaseLease(id uint, owner string) error
+	ReleaseLeases(owner string) (int64, error)
+	ReclaimExpiredLeases() (int64, error)
+	AddUserDevices(id uint, tokens []string) error
+	MarkNotificationAsProcessed(id uint, attempts int, lastErr error) error
+	ScheduleRetry(id uint, attempts int, nextAttempt time.Time, lastError string) error
+	RescheduleNotification(id uint, sendAt *time.Time) error
+	CancelNotification(id uint, reason, cancelledBy string) (bool, error)
+	IsCancelled(id uint) bool
+	ReplayDeadLetter(id uint) (uint, error)
+	CreateDeadLetter(deadLetter *DeadLetter) error
+	PurgeDeadLetters(ids []uint, olderThan time.Time) (int64, error)
+	CreateDeliveries(deliveries []Delivery) error
+	RecordRecipientOutcomes(notificationID uint, targets []string, responses []*messaging.SendResponse) error
+	CancelRecipients(notificationID uint, targets []string) (int64, error)
+	RecordDeadTokens(entries []TokenHealth) error
+	RegisterDevice(d *Device) error
+	UpdateDevice(d Device) (Device, error)
+	RemoveDevices(userID, token string) (int64, error)
+	CleanupExpiredIdempotencyKeys() (int64, error)
+	DeleteExpiredNotifications(status Status, olderThan time.Time, limit int) (CleanupCounts, error)
+	Compact() error
+	FetchNotificationStatus(id uint) (StatusSummary, error)
+	QueueDepth() (due, delayed, scheduled, leased int64, err error)
+	Close() error
+}
+
+// StoreConfig selects the database backend. Driver is "sqlite" or "postgres"; DSN is the
+// database file for SQLite and a connection string for Postgres. BusyTimeout is how long a
+// SQLite write waits for another one to finish before failing.
+type StoreConfig struct {
+	Driver      string
+	DSN         string
+	BusyTimeout time.Duration
+}
+
+func openStore(cfg StoreConfig) (Store, *gorm.DB, error) {
+	switch cfg.Driver {
+	case "", "sqlite":
+		s, err := openSQLite(cfg.DSN, cfg.BusyTimeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, s.db, nil
+	case "postgres":
+		s, err := openPostgres(cfg.DSN)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, s.db, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+}
+
+// sqlStore holds what the backends have in common
+type sqlStore struct {
+	db *gorm.DB
+}
+
+func (s *sqlStore) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// save stores a batch of notifications in a single transaction, see SaveNotifications
+func (s *sqlStore) save(notifications []Notification) ([]SaveResult, error) {
+	results := make([]SaveResult, len(notifications))
+
+	err := s.write(func(tx *gorm.DB) error {
+		for i := range notifications {
+			n := notifications[i]
+			n.ID = 0
+			id, duplicate, err := saveNotification(tx, &n)
+			if err != nil {
+				return err
+			}
+			results[i] = SaveResult{ID: id, Duplicate: duplicate}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// write runs fn in a transaction, retrying while a concurrent request won an idempotency key
+func (s *sqlStore) write(fn func(tx *gorm.DB) error) error {
+	const maxRetries int = 10
+
+	for i := 0; i < maxRetries; i++ {
+		err := s.db.Transaction(fn)
+		if err == nil {
+			return nil
+		}
+
+		// Another request claimed the same idempotency key first, the next try returns its ID
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			log.InfoLogger.Printf("Duplicate notification detected: %v", err)
+			continue
+		}
+
+		return err
+	}
+
+	log.ErrorLogger.Errorf("Failed to save after %v tries", maxRetries)
+
+	return fmt.Errorf("failed to save notification after %d retries", maxRetries)
+}
+
+// claim leases due notifications to owner, see ClaimNotifications. lock is added to the query
+// picking the rows, for engines where the UPDATE alone does not keep two claims apart.
+func (s *sqlStore) claim(owner string, limit int, lease time.Duration, lock clause.Expression) ([]Notification, error) {
+	var notifications []Notification
+	if limit <= 0 {
+		return notifications, nil
+	}
+
+	now := time.Now()
+	due := s.db.Model(&Notification{}).
+		Select("id").
+		Where("processed = ? AND processing = ?", false, false).
+		Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+		Where("send_at IS NULL OR send_at <= ?", now).
+		Order("id").
+		Limit(limit)
+	if lock != nil {
+		due = due.Clauses(lock)
+	}
+
+	err := s.db.Model(&notifications).
+		Clauses(clause.Returning{}).
+		Where("id IN (?)", due).
+		Updates(map[string]interface{}{
+			"processing":       true,
+			"status":           StatusSending,
+			"lease_owner":      owner,
+			"lease_expires_at": now.Add(lease),
+		}).Error
+	return notifications, err
+}
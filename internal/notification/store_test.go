@@ -0,0 +1,125 @@
+package notification
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// openPostgresTestDB migrates the database TEST_POSTGRES_DSN points to and empties the
+// notification tables, or skips the test when it is not set
+func openPostgresTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	setupTestLoggers()
+
+	db, err := InitDB(StoreConfig{Driver: "postgres", DSN: dsn}, true)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+
+	truncate := func() error {
+		return db.Exec("TRUNCATE notifications, recipients, deliveries, idempotency_keys RESTART IDENTITY").Error
+	}
+	if err := truncate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		truncate()
+		CloseDB()
+	})
+	return db
+}
+
+// saveTestNotifications queues count notifications with one token each
+func saveTestNotifications(t *testing.T, count int) {
+	t.Helper()
+
+	notifications := make([]Notification, count)
+	for i := range notifications {
+		notifications[i] = Notification{Message: "m", Tokens: []string{fmt.Sprintf("t%d", i)}}
+	}
+	if _, err := SaveNotifications(notifications); err != nil {
+		t.Fatalf("SaveNotifications: %v", err)
+	}
+}
+
+// claimConcurrently has owners claim batches of limit notifications at the same time until
+// nothing is left, and returns the owners that claimed each notification
+func claimConcurrently(t *testing.T, owners, limit int) map[uint][]string {
+	t.Helper()
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		claimedBy = map[uint][]string{}
+		errs      = make(chan error, owners)
+	)
+	for i := 0; i < owners; i++ {
+		owner := fmt.Sprintf("owner-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				claimed, err := ClaimNotifications(owner, limit, time.Minute)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(claimed) == 0 {
+					return
+				}
+
+				mu.Lock()
+				for _, n := range claimed {
+					claimedBy[n.ID] = append(claimedBy[n.ID], owner)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("ClaimNotifications: %v", err)
+	}
+	return claimedBy
+}
+
+// assertClaimedOnce checks that each of count notifications went to exactly one owner, and that
+// the owner holds the lease in the database
+func assertClaimedOnce(t *testing.T, db *gorm.DB, claimedBy map[uint][]string, count int) {
+	t.Helper()
+
+	if len(claimedBy) != count {
+		t.Errorf("claimed %d notifications, want %d", len(claimedBy), count)
+	}
+	for id, owners := range claimedBy {
+		if len(owners) != 1 {
+			t.Errorf("notification %d was claimed by %v", id, owners)
+			continue
+		}
+
+		var n Notification
+		db.First(&n, id)
+		if !n.Processing || n.LeaseOwner != owners[0] {
+			t.Errorf("notification %d is processing=%v with lease owner %q, want %s", id, n.Processing, n.LeaseOwner, owners[0])
+		}
+	}
+}
+
+func TestClaimNotificationsConcurrentlyPostgres(t *testing.T) {
+	db := openPostgresTestDB(t)
+
+	saveTestNotifications(t, 200)
+	assertClaimedOnce(t, db, claimConcurrently(t, 8, 10), 200)
+}
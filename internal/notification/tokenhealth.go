@@ -0,0 +1,150 @@
+package notification
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TokenHealth records a device token FCM reported as unregistered or invalid. Such tokens are
+// never going to receive anything again, so they are suppressed on new notifications.
+type TokenHealth struct {
+	ID             uint      `gorm:"primarykey"`
+	Token          string    `gorm:"type:text;uniqueIndex"`
+	ErrorCode      string    `gorm:"type:string"`
+	Error          string    `gorm:"type:text"`
+	FailureCount   int       `gorm:"column:failure_count"`
+	NotificationID uint      `gorm:"column:notification_id"`
+	FirstFailedAt  time.Time `gorm:"column:first_failed_at"`
+	LastFailedAt   time.Time `gorm:"column:last_failed_at;index"`
+}
+
+func (TokenHealth) TableName() string {
+	return "token_health"
+}
+
+// isDeadToken reports whether an FCM error means the token itself is no longer usable. FCM also
+// answers INVALID_ARGUMENT for payload problems such as oversized data or a bad TTL, so that code
+// only counts when the error is about the registration token. A chunk that failed as a whole says
+// nothing about its tokens.
+func isDeadToken(err error) bool {
+	var chunkErr *ChunkError
+	if errors.As(err, &chunkErr) {
+		return false
+	}
+	return messaging.IsUnregistered(err) || (messaging.IsInvalidArgument(err) && namesRegistrationToken(err.Error()))
+}
+
+// namesRegistrationToken reports whether an FCM error message is about the registration token,
+// as in "The registration token is not a valid FCM registration token"
+func namesRegistrationToken(message string) bool {
+	return strings.Contains(strings.ToLower(message), "registration token")
+}
+
+// RecordDeadTokens adds tokens to the registry, or refreshes the entry of tokens already in it.
+// Registered devices are only removed for unregistered tokens. Devices with an invalid token stay
+// registered and are still sent to through their user until the app registers them again.
+func RecordDeadTokens(entries []TokenHealth) error {
+	return store.RecordDeadTokens(entries)
+}
+
+func (s *sqlStore) RecordDeadTokens(entries []TokenHealth) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var unregistered []string
+	for _, e := range entries {
+		if e.ErrorCode == "UNREGISTERED" {
+			unregistered = append(unregistered, e.Token)
+		}
+	}
+	if err := removeDeadDevices(s.db, unregistered); err != nil {
+		return err
+	}
+
+	return s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "token"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"error_code":      gorm.Expr("excluded.error_code"),
+			"error":           gorm.Expr("excluded.error"),
+			"notification_id": gorm.Expr("excluded.notification_id"),
+			"last_failed_at":  gorm.Expr("excluded.last_failed_at"),
+			"failure_count":   gorm.Expr("token_health.failure_count + 1"),
+		}),
+	}).CreateInBatches(&entries, 100).Error
+}
+
+// FilterDeadTokens splits tokens into those that can still be sent to and those known to be dead
+func FilterDeadTokens(tokens []string) (alive []string, dead []string, err error) {
+	return filterDeadTokens(tokens)
+}
+
+// filterDeadTokens is FilterDeadTokens limited to tokens that died with one of codes, or with any
+// error code when none are given
+func filterDeadTokens(tokens []string, codes ...string) (alive []string, dead []string, err error) {
+	if len(tokens) == 0 {
+		return tokens, nil, nil
+	}
+
+	known := map[string]bool{}
+	err = inChunks(tokens, func(chunk []string) error {
+		query := db.Model(&TokenHealth{}).Where("token IN ?", chunk)
+		if len(codes) > 0 {
+			query = query.Where("error_code IN ?", codes)
+		}
+
+		var found []string
+		if err := query.Pluck("token", &found).Error; err != nil {
+			return err
+		}
+		for _, token := range found {
+			known[token] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, token := range tokens {
+		if known[token] {
+			dead = append(dead, token)
+		} else {
+			alive = append(alive, token)
+		}
+	}
+	return alive, dead, nil
+}
+
+// maxInValues is how many values go into one IN list, well below SQLite's bound variable limit
+const maxInValues = 500
+
+// inChunks calls fn with consecutive chunks of values, each small enough for an IN list
+func inChunks(values []string, fn func(chunk []string) error) error {
+	for start := 0; start < len(values); start += maxInValues {
+		end := start + maxInValues
+		if end > len(values) {
+			end = len(values)
+		}
+		if err := fn(values[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchDeadTokens pages through the registry in ID order, starting after afterID and only
+// including tokens that failed at or after since
+func FetchDeadTokens(since time.Time, afterID uint, limit int) ([]TokenHealth, error) {
+	var entries []TokenHealth
+	err := db.Where("id > ? AND last_failed_at >= ?", afterID, since).
+		Order("id").
+		Limit(limit).
+		Find(&entries).Error
+	return entries, err
+}
@@ -0,0 +1,102 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/messaging"
+	"google.golang.org/api/option"
+)
+
+// fcmError returns the error the messaging client reports for an FCM v1 error response
+func fcmError(t *testing.T, status int, code, message string) error {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"error": {"code": %d, "message": %q, "details": [{"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError", "errorCode": %q}]}}`,
+			status, message, code)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	app, err := firebase.NewApp(ctx, &firebase.Config{ProjectID: "test"}, option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := app.Messaging(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Send(ctx, &messaging.Message{Token: "t"})
+	if err == nil {
+		t.Fatal("Send did not fail")
+	}
+	return err
+}
+
+func TestIsDeadToken(t *testing.T) {
+	unregistered := fcmError(t, http.StatusNotFound, "UNREGISTERED", "Requested entity was not found.")
+	invalidToken := fcmError(t, http.StatusBadRequest, "INVALID_ARGUMENT", "The registration token is not a valid FCM registration token")
+	invalidPayload := fcmError(t, http.StatusBadRequest, "INVALID_ARGUMENT", "Message is too big")
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unregistered", unregistered, true},
+		{"invalid token", invalidToken, true},
+		{"invalid payload", invalidPayload, false},
+		{"chunk failed", &ChunkError{Err: unregistered}, false},
+		{"other", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		if got := isDeadToken(tt.err); got != tt.want {
+			t.Errorf("%s: isDeadToken = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWorkerKeepsTokensAlive(t *testing.T) {
+	invalidPayload := fcmError(t, http.StatusBadRequest, "INVALID_ARGUMENT", "Message is too big")
+	unregistered := fcmError(t, http.StatusNotFound, "UNREGISTERED", "Requested entity was not found.")
+
+	tests := []struct {
+		name     string
+		sendEach func(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error)
+	}{
+		{"rejected payload", func(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+			resp := &messaging.BatchResponse{}
+			for range messages {
+				resp.Responses = append(resp.Responses, &messaging.SendResponse{Error: invalidPayload})
+			}
+			return resp, nil
+		}},
+		{"failed chunk", func(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+			return nil, unregistered
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+
+			if _, _, err := SaveNotification(Notification{Message: "m", Tokens: []string{"a", "b"}}); err != nil {
+				t.Fatalf("SaveNotification: %v", err)
+			}
+			runWorker(t, tt.sendEach)
+
+			alive, dead, err := FilterDeadTokens([]string{"a", "b"})
+			if err != nil || len(alive) != 2 {
+				t.Errorf("tokens %v were marked dead: %v", dead, err)
+			}
+		})
+	}
+}
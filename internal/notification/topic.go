@@ -0,0 +1,117 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+// maxTopicBatchSize is the most tokens FCM accepts in one topic management call
+const maxTopicBatchSize = 1000
+
+// maxConditionTopics is the most topics FCM allows in one condition
+const maxConditionTopics = 5
+
+var (
+	// topicNamePattern is the topic name pattern of the Firebase SDK
+	topicNamePattern = regexp.MustCompile("^(/topics/)?(private/)?[a-zA-Z0-9-_.~%]+$")
+
+	conditionTopicPattern    = regexp.MustCompile(`'([^']*)'\s+in\s+topics`)
+	conditionOperatorPattern = regexp.MustCompile(`^[\s()!&|]*$`)
+)
+
+// ValidateTopic checks a topic name the way the Firebase SDK does. The SDK rejects a whole
+// SendEach batch when one of its messages has a malformed topic, so topics are checked before
+// they are queued next to device tokens.
+func ValidateTopic(topic string) error {
+	if !topicNamePattern.MatchString(topic) {
+		return fmt.Errorf("malformed topic name %q", topic)
+	}
+	return nil
+}
+
+// ValidateCondition checks that a condition is made of up to five "'topic' in topics" clauses
+// with valid topic names joined by &&, || and ! with parentheses
+func ValidateCondition(condition string) error {
+	clauses := conditionTopicPattern.FindAllStringSubmatch(condition, -1)
+	if len(clauses) == 0 {
+		return fmt.Errorf("condition %q has no topics", condition)
+	}
+	if len(clauses) > maxConditionTopics {
+		return fmt.Errorf("condition has %d topics, at most %d are allowed", len(clauses), maxConditionTopics)
+	}
+
+	for _, clause := range clauses {
+		if err := ValidateTopic(clause[1]); err != nil {
+			return err
+		}
+	}
+
+	if !conditionOperatorPattern.MatchString(conditionTopicPattern.ReplaceAllString(condition, "")) {
+		return fmt.Errorf("malformed condition %q", condition)
+	}
+	return nil
+}
+
+// splitTargets separates device tokens from the topic and condition in a list of targets
+func splitTargets(targets []string) (tokens []string, topic, condition string) {
+	for _, target := range targets {
+		switch {
+		case strings.HasPrefix(target, topicPrefix):
+			topic = strings.TrimPrefix(target, topicPrefix)
+		case strings.HasPrefix(target, conditionPrefix):
+			condition = strings.TrimPrefix(target, conditionPrefix)
+		default:
+			tokens = append(tokens, target)
+		}
+	}
+	return tokens, topic, condition
+}
+
+// SubscribeToTopic subscribes device tokens to a topic. Error indexes refer to tokens.
+func SubscribeToTopic(ctx context.Context, tokens []string, topic string) (*messaging.TopicManagementResponse, error) {
+	return manageTopic(ctx, tokens, topic, func(c *messaging.Client, tokens []string) (*messaging.TopicManagementResponse, error) {
+		return c.SubscribeToTopic(ctx, tokens, topic)
+	})
+}
+
+// UnsubscribeFromTopic unsubscribes device tokens from a topic. Error indexes refer to tokens.
+func UnsubscribeFromTopic(ctx context.Context, tokens []string, topic string) (*messaging.TopicManagementResponse, error) {
+	return manageTopic(ctx, tokens, topic, func(c *messaging.Client, tokens []string) (*messaging.TopicManagementResponse, error) {
+		return c.UnsubscribeFromTopic(ctx, tokens, topic)
+	})
+}
+
+// manageTopic calls fn in batches FCM accepts and merges the responses
+func manageTopic(ctx context.Context, tokens []string, topic string,
+	fn func(c *messaging.Client, tokens []string) (*messaging.TopicManagementResponse, error)) (*messaging.TopicManagementResponse, error) {
+	if sender == nil {
+		return nil, fmt.Errorf("sender not initialised")
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("topic is required")
+	}
+
+	merged := &messaging.TopicManagementResponse{}
+	for start := 0; start < len(tokens); start += maxTopicBatchSize {
+		end := start + maxTopicBatchSize
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+
+		resp, err := fn(sender.Client(), tokens[start:end])
+		if err != nil {
+			return merged, err
+		}
+
+		merged.SuccessCount += resp.SuccessCount
+		merged.FailureCount += resp.FailureCount
+		for _, e := range resp.Errors {
+			merged.Errors = append(merged.Errors, &messaging.ErrorInfo{Index: start + e.Index, Reason: e.Reason})
+		}
+	}
+	return merged, nil
+}
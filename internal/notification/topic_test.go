@@ -0,0 +1,46 @@
+package notification
+
+import "testing"
+
+func TestValidateTopic(t *testing.T) {
+	tests := []struct {
+		topic string
+		valid bool
+	}{
+		{"news", true},
+		{"/topics/news", true},
+		{"private/news-2024_v1.~%", true},
+		{"", false},
+		{"breaking news", false},
+		{"news/sports", false},
+		{"news!", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateTopic(tt.topic); (err == nil) != tt.valid {
+			t.Errorf("ValidateTopic(%q) = %v, want valid %v", tt.topic, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateCondition(t *testing.T) {
+	tests := []struct {
+		condition string
+		valid     bool
+	}{
+		{"'news' in topics", true},
+		{"'android' in topics && ('news' in topics || !('sports' in topics))", true},
+		{"'a' in topics || 'b' in topics || 'c' in topics || 'd' in topics || 'e' in topics", true},
+		{"'a' in topics || 'b' in topics || 'c' in topics || 'd' in topics || 'e' in topics || 'f' in topics", false},
+		{"", false},
+		{"news", false},
+		{"'bad topic' in topics", false},
+		{"'news' in topics; DROP", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateCondition(tt.condition); (err == nil) != tt.valid {
+			t.Errorf("ValidateCondition(%q) = %v, want valid %v", tt.condition, err, tt.valid)
+		}
+	}
+}
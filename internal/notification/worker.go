@@ -2,116 +2,218 @@ package notification
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"go-noti-server/internal/log"
 
-	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/messaging"
 	"github.com/newrelic/go-agent/v3/newrelic"
-	"google.golang.org/api/option"
 )
 
-func Worker(id int, notificationChan <-chan Notification) {
-	for notification := range notificationChan {
+// Worker sends notifications from notificationChan until the channel is closed or stop is closed
+func Worker(id int, notificationChan <-chan Notification, stop <-chan struct{}) {
+	for {
+		// A stopped worker takes nothing more, even when the channel has notifications ready
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		var notification Notification
+		select {
+		case <-stop:
+			return
+		case n, ok := <-notificationChan:
+			if !ok {
+				return
+			}
+			notification = n
+		}
+
+		result := processNotification(notification, id)
+
+		if result.requeue {
+			requeueNotification(notification, result.err, id)
+			continue
+		}
 
-		processNotification(notification, id)
+		if !IsCancelled(notification.ID) {
+			// Targets that failed for good are dead-lettered now, retrying will not change them
+			deadLetter(notification, result.permanent, id)
 
-		if err := MarkNotificationAsProcessed(notification.ID); err != nil {
+			if len(result.failedTokens) > 0 {
+				if retryNotification(notification, result, id) {
+					continue
+				}
+
+				var exhausted []failedTarget
+				for _, token := range result.failedTokens {
+					exhausted = append(exhausted, failedTarget{target: token, err: result.retryErr})
+				}
+				deadLetter(notification, exhausted, id)
+			}
+		}
+
+		if err := MarkNotificationAsProcessed(notification.ID, notification.Attempts+1, result.err); err != nil {
 			log.InfoLogger.Printf("ERROR: %+v", err)
 		}
 	}
 }
 
-func processNotification(notification Notification, workerId int) {
-	txn := log.NewRelicApp.StartTransaction(fmt.Sprintf("Worker-%d", workerId))
+// sendResult is the outcome of one attempt at a notification. failedTokens are the tokens that
+// were not delivered because of a transient error, the last of which is retryErr, and are sent
+// again on a later attempt. permanent are the targets that failed with an error a retry cannot
+// fix, such as a rejected payload or credentials, whether FCM reported it for the target or for
+// its whole chunk. err is the last error seen, if any.
+type sendResult struct {
+	failedTokens []string
+	retryAfter   time.Duration
+	retryErr     error
+	permanent    []failedTarget
+	err          error
 
-	defer txn.End()
+	// requeue is set when nothing was sent because the notification could not be loaded, it is
+	// tried again later
+	requeue bool
+}
 
-	var (
-		auth = os.Getenv("AUTH_FILE")
-		ctx  = newrelic.NewContext(context.Background(), txn)
-		opt  = option.WithCredentialsFile(auth)
-	)
+// failedTarget is a target that was not delivered and the error it failed with
+type failedTarget struct {
+	target string
+	err    error
+}
 
-	app, err := firebase.NewApp(ctx, nil, opt)
-	if err != nil {
-		txn.NoticeError(err)
-		log.ErrorLogger.Printf("ERROR: %+v", err)
-		txn.AddAttribute("error", fmt.Sprintf("Firebase init error: %v", err))
+// deadLetter saves the failed targets of a notification as dead letters, one per FCM error code
+func deadLetter(notification Notification, failed []failedTarget, workerId int) {
+	var codes []string
+	byCode := map[string][]failedTarget{}
+	for _, f := range failed {
+		code := errorCode(f.err)
+		if _, ok := byCode[code]; !ok {
+			codes = append(codes, code)
+		}
+		byCode[code] = append(byCode[code], f)
+	}
+
+	for _, code := range codes {
+		group := byCode[code]
+		tokens := make([]string, 0, len(group))
+		for _, f := range group {
+			tokens = append(tokens, f.target)
+		}
+
+		if err := SaveDeadLetter(notification, tokens, notification.Attempts+1, code, group[len(group)-1].err); err != nil {
+			log.ErrorLogger.Printf("Worker-%d: Failed to dead-letter notification %d: %v", workerId, notification.ID, err)
+		}
+	}
+}
+
+// retryNotification schedules another attempt for the failed tokens. It returns false once the
+// notification has used up its attempts.
+func retryNotification(notification Notification, result sendResult, workerId int) bool {
+	attempt := notification.Attempts + 1
+	if attempt >= retryPolicy.MaxAttempts {
+		log.ErrorLogger.Printf("Worker-%d: Giving up on notification %d after %d attempts: %v",
+			workerId, notification.ID, attempt, result.err)
+		return false
+	}
+
+	delay := retryPolicy.Backoff(attempt, result.retryAfter)
+	nextAttempt := time.Now().Add(delay)
+
+	var lastError string
+	if result.err != nil {
+		lastError = result.err.Error()
+	}
+
+	if err := ScheduleRetry(notification.ID, attempt, nextAttempt, lastError); err != nil {
+		log.ErrorLogger.Printf("Worker-%d: Failed to schedule retry for notification %d: %v", workerId, notification.ID, err)
+		return false
+	}
+
+	log.InfoLogger.Printf("Worker-%d: Retrying %d tokens of notification %d in %v (attempt %d of %d)",
+		workerId, len(result.failedTokens), notification.ID, delay, attempt+1, retryPolicy.MaxAttempts)
+	return true
+}
+
+// requeueNotification puts a notification that could not be loaded back in the queue after a
+// backoff. The failure counts as an attempt, so a notification that keeps failing is given up on
+// instead of being claimed again right away forever.
+func requeueNotification(notification Notification, err error, workerId int) {
+	attempt := notification.Attempts + 1
+	if attempt >= retryPolicy.MaxAttempts || IsCancelled(notification.ID) {
+		log.ErrorLogger.Printf("Worker-%d: Giving up on notification %d after %d attempts: %v",
+			workerId, notification.ID, attempt, err)
+		if err := MarkNotificationAsProcessed(notification.ID, attempt, err); err != nil {
+			log.ErrorLogger.Printf("Worker-%d: Failed to finish notification %d: %v", workerId, notification.ID, err)
+		}
 		return
 	}
 
-	fcmClient, err := app.Messaging(ctx)
-	if err != nil {
-		log.ErrorLogger.Printf("ERROR: %+v", err)
-		txn.AddAttribute("error", fmt.Sprintf("FCM Error: %v", err))
+	delay := retryPolicy.Backoff(attempt, 0)
+	if err := ScheduleRetry(notification.ID, attempt, time.Now().Add(delay), err.Error()); err != nil {
+		log.ErrorLogger.Printf("Worker-%d: Failed to requeue notification %d: %v", workerId, notification.ID, err)
 		return
 	}
 
-	fcmStart := time.Now()
+	log.InfoLogger.Printf("Worker-%d: Requeued notification %d for %v (attempt %d of %d)",
+		workerId, notification.ID, delay, attempt+1, retryPolicy.MaxAttempts)
+}
 
-	var messages []*messaging.Message
+func processNotification(notification Notification, workerId int) sendResult {
+	txn := log.NewRelicApp.StartTransaction(fmt.Sprintf("Worker-%d", workerId))
 
-	deviceTokens := split(notification.DeviceTokens, ",")
-	if deviceTokens == nil {
-		log.ErrorLogger.Printf("Worker-%d: deviceTokens is nil", workerId)
-		txn.AddAttribute("error", "deviceTokens is nil")
-		return
+	defer txn.End()
+
+	ctx := newrelic.NewContext(context.Background(), txn)
+
+	if err := expandUserDevices(notification); err != nil {
+		log.ErrorLogger.Printf("Worker-%d: Failed to look up devices of notification %d: %v", workerId, notification.ID, err)
+		return sendResult{requeue: true, err: err}
 	}
 
-	data := parseData(notification.Data)
+	// Device tokens, topic and condition still to be sent
+	deviceTokens, err := pendingTargets(notification.ID)
+	if err != nil {
+		log.ErrorLogger.Printf("Worker-%d: Failed to load recipients of notification %d: %v", workerId, notification.ID, err)
+		return sendResult{requeue: true, err: err}
+	}
+	if len(deviceTokens) == 0 {
+		cancelled, err := countRecipients(notification.ID, RecipientCancelled)
+		if err != nil {
+			log.ErrorLogger.Printf("Worker-%d: Failed to load recipients of notification %d: %v", workerId, notification.ID, err)
+			return sendResult{requeue: true, err: err}
+		}
+		if cancelled > 0 {
+			log.InfoLogger.Printf("Worker-%d: Every target of notification %d was cancelled", workerId, notification.ID)
+			return sendResult{}
+		}
 
-	var channelId string
+		log.ErrorLogger.Printf("Worker-%d: notification %d has no targets", workerId, notification.ID)
+		txn.AddAttribute("error", "no targets")
+		return sendResult{err: fmt.Errorf("notification has no device tokens, topic or condition")}
+	}
 
-	if value, ok := data["channelId"]; ok {
-		channelId = value
+	if sender == nil {
+		err := fmt.Errorf("sender not initialised")
+		log.ErrorLogger.Printf("ERROR: %+v", err)
+		txn.AddAttribute("error", fmt.Sprintf("FCM Error: %v", err))
+		return sendResult{failedTokens: deviceTokens, retryErr: err, err: err}
 	}
 
+	fcmStart := time.Now()
+
+	var messages []*messaging.Message
+
+	data := ParseData(notification.Data)
+	overrides := ParseOverrides(notification.Overrides)
+
 	for _, deviceToken := range deviceTokens {
-		msg := &messaging.Message{
-			Android: &messaging.AndroidConfig{
-				Priority: "high",
-				Notification: &messaging.AndroidNotification{
-					Title:     notification.Title,
-					Body:      notification.Body,
-					ImageURL:  notification.Image,
-					ChannelID: channelId,
-				},
-				Data: data,
-			},
-			APNS: &messaging.APNSConfig{
-				Headers: map[string]string{
-					"apns-priority": "10",
-				},
-				Payload: &messaging.APNSPayload{
-					Aps: &messaging.Aps{
-						Alert: &messaging.ApsAlert{
-							Title:       notification.Title,
-							Body:        notification.Body,
-							LaunchImage: notification.Image,
-						},
-						Sound: "default",
-					},
-					CustomData: map[string]interface{}{
-						"image-url": notification.Image, // Custom key to handle image URL in your app
-						"data":      data,
-					},
-				},
-			},
-			Notification: &messaging.Notification{
-				Title:    notification.Title,
-				Body:     notification.Body,
-				ImageURL: notification.Image,
-			},
-			FCMOptions: &messaging.FCMOptions{
-				AnalyticsLabel: notification.AnalyticsLabel,
-			},
-			Token: deviceToken, // Assuming a single device token for simplicity. Still janky. Should be a loop.
-			Data:  data,
-		}
+		msg := newMessage(notification, data, overrides)
+		setTarget(msg, deviceToken)
 		messages = append(messages, msg)
 	}
 	// Send() is very slow.. DO NOT USE..
@@ -119,20 +221,21 @@ func processNotification(notification Notification, workerId int) {
 
 	apiCallSegment := txn.StartSegment("SendEach FCM Messages")
 
-	msgResponse, err := fcmClient.SendEach(ctx, messages)
-	if msgResponse == nil {
-		log.ErrorLogger.Printf("Worker-%d: msgResponse is nil", workerId)
-		txn.AddAttribute("error", "msgResponse is nil")
-		return
-	}
-	if err != nil {
-		log.ErrorLogger.Printf("ERROR: %+v", err)
-		log.ErrorLogger.Printf("Worker-%d: Error sending FCM messages: %+v", workerId, err)
-		txn.AddAttribute("error", fmt.Sprintf("Send FCM error: %v", err))
-	}
+	msgResponse := sender.SendEachChunked(ctx, messages, func() bool {
+		return IsCancelled(notification.ID)
+	})
 	apiCallSegment.End()
 
 	fcmEnd := time.Now()
+
+	if err := SaveDeliveries(notification.ID, notification.Attempts+1, deviceTokens, msgResponse.Responses, fcmEnd); err != nil {
+		log.ErrorLogger.Printf("Worker-%d: Failed to save deliveries for notification %d: %v", workerId, notification.ID, err)
+		txn.NoticeError(err)
+	}
+	if err := recordRecipientOutcomes(notification.ID, deviceTokens, msgResponse.Responses); err != nil {
+		log.ErrorLogger.Printf("Worker-%d: Failed to update recipients of notification %d: %v", workerId, notification.ID, err)
+		txn.NoticeError(err)
+	}
 	apiTrip := fcmEnd.Sub(apiCall)
 
 	fcmDiff := fcmEnd.Sub(fcmStart)
@@ -143,6 +246,49 @@ func processNotification(notification Notification, workerId int) {
 	txn.AddAttribute("worker_id", workerId)
 	txn.AddAttribute("fcm_time", fcmDiff.String())
 	txn.AddAttribute("api_round_trip", apiTrip.String())
-	txn.AddAttribute("success_count", msgResponse)
+	txn.AddAttribute("chunk_count", (len(messages)+MaxBatchSize-1)/MaxBatchSize)
+	txn.AddAttribute("success_count", msgResponse.SuccessCount)
 	txn.AddAttribute("failure_count", msgResponse.FailureCount)
+
+	var (
+		result     sendResult
+		deadTokens []TokenHealth
+	)
+	for i, resp := range msgResponse.Responses {
+		if resp.Success || i >= len(deviceTokens) || errors.Is(resp.Error, ErrCancelled) {
+			continue
+		}
+
+		result.err = resp.Error
+		if isDeadToken(resp.Error) && isDeviceToken(deviceTokens[i]) {
+			deadTokens = append(deadTokens, TokenHealth{
+				Token:          deviceTokens[i],
+				ErrorCode:      errorCode(resp.Error),
+				Error:          resp.Error.Error(),
+				FailureCount:   1,
+				NotificationID: notification.ID,
+				FirstFailedAt:  fcmEnd,
+				LastFailedAt:   fcmEnd,
+			})
+			continue
+		}
+		if isRetryable(resp.Error) {
+			result.failedTokens = append(result.failedTokens, deviceTokens[i])
+			result.retryErr = resp.Error
+			if after := retryAfter(resp.Error); after > result.retryAfter {
+				result.retryAfter = after
+			}
+			continue
+		}
+		result.permanent = append(result.permanent, failedTarget{target: deviceTokens[i], err: resp.Error})
+	}
+	txn.AddAttribute("retry_count", len(result.failedTokens))
+	txn.AddAttribute("permanent_failure_count", len(result.permanent))
+	txn.AddAttribute("dead_token_count", len(deadTokens))
+
+	if err := RecordDeadTokens(deadTokens); err != nil {
+		log.ErrorLogger.Printf("Worker-%d: Failed to record dead tokens for notification %d: %v", workerId, notification.ID, err)
+	}
+
+	return result
 }
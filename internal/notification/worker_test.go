@@ -0,0 +1,208 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+// runWorker sends the due notifications through a worker whose FCM calls go to sendEach
+func runWorker(t *testing.T, sendEach func(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error)) {
+	t.Helper()
+
+	sender = &Sender{parallelism: 1, sendEach: sendEach}
+	t.Cleanup(func() { sender = nil })
+
+	claimed, err := ClaimNotifications("test", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNotifications: %v", err)
+	}
+
+	notifications := make(chan Notification, len(claimed))
+	for _, n := range claimed {
+		notifications <- n
+	}
+	close(notifications)
+
+	Worker(1, notifications, make(chan struct{}))
+}
+
+func TestWorkerDeadLettersChunkWithNonRetryableError(t *testing.T) {
+	openTestDB(t)
+
+	id, _, err := SaveNotification(Notification{Message: "m", Tokens: []string{"a", "b", "c"}})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+
+	// The whole chunk is rejected, as FCM does for invalid credentials or a malformed payload
+	calls := 0
+	runWorker(t, func(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+		calls++
+		return nil, errors.New("invalid payload")
+	})
+
+	if calls != 1 {
+		t.Errorf("got %d SendEach calls, want 1", calls)
+	}
+
+	var n Notification
+	db.First(&n, id)
+	if !n.Processed || n.Status != StatusFailed {
+		t.Errorf("notification is processed=%v status=%s, want a failed notification", n.Processed, n.Status)
+	}
+
+	deadLetters, total, err := FetchDeadLetters(10, 0, false)
+	if err != nil {
+		t.Fatalf("FetchDeadLetters: %v", err)
+	}
+	if total != 1 {
+		t.Fatalf("got %d dead letters, want 1", total)
+	}
+	if deadLetters[0].DeviceTokens != "a,b,c" || deadLetters[0].LastError != "invalid payload" {
+		t.Errorf("dead letter has tokens %q and error %q", deadLetters[0].DeviceTokens, deadLetters[0].LastError)
+	}
+}
+
+func TestWorkerDeadLettersTokensWithPermanentErrors(t *testing.T) {
+	openTestDB(t)
+
+	id, _, err := SaveNotification(Notification{Message: "m", Tokens: []string{"a", "b", "c"}})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+
+	runWorker(t, func(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+		resp := &messaging.BatchResponse{}
+		for _, msg := range messages {
+			if msg.Token == "a" {
+				resp.Responses = append(resp.Responses, &messaging.SendResponse{Success: true, MessageID: "m1"})
+				continue
+			}
+			resp.Responses = append(resp.Responses, &messaging.SendResponse{Error: errors.New("rejected by FCM")})
+		}
+		return resp, nil
+	})
+
+	var n Notification
+	db.First(&n, id)
+	if n.Status != StatusPartiallyFailed {
+		t.Errorf("got status %s, want %s", n.Status, StatusPartiallyFailed)
+	}
+
+	deadLetters, total, err := FetchDeadLetters(10, 0, false)
+	if err != nil {
+		t.Fatalf("FetchDeadLetters: %v", err)
+	}
+	if total != 1 {
+		t.Fatalf("got %d dead letters, want 1", total)
+	}
+	if d := deadLetters[0]; d.DeviceTokens != "b,c" || d.ErrorCode != "UNKNOWN" {
+		t.Errorf("dead letter has tokens %q and error code %q, want b,c and UNKNOWN", d.DeviceTokens, d.ErrorCode)
+	}
+}
+
+func TestWorkerDeadLettersTopicAndConditionSeparately(t *testing.T) {
+	openTestDB(t)
+
+	_, _, err := SaveNotification(Notification{Message: "m", Tokens: []string{"a"}, Topic: "news", Condition: "'news' in topics"})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+
+	runWorker(t, func(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+		return nil, errors.New("invalid payload")
+	})
+
+	deadLetters, _, err := FetchDeadLetters(10, 0, false)
+	if err != nil || len(deadLetters) != 1 {
+		t.Fatalf("got %d dead letters: %v", len(deadLetters), err)
+	}
+	d := deadLetters[0]
+	if d.DeviceTokens != "a" || d.Topic != "news" || d.Condition != "'news' in topics" {
+		t.Errorf("dead letter has tokens %q, topic %q and condition %q", d.DeviceTokens, d.Topic, d.Condition)
+	}
+
+	if _, err := ReplayDeadLetter(d.ID); err != nil {
+		t.Fatalf("ReplayDeadLetter: %v", err)
+	}
+	targets, err := pendingTargets(d.NotificationID)
+	if err != nil || len(targets) != 3 {
+		t.Errorf("replay left %v pending: %v", targets, err)
+	}
+}
+
+func sendAll(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+	resp := &messaging.BatchResponse{}
+	for range messages {
+		resp.Responses = append(resp.Responses, &messaging.SendResponse{Success: true, MessageID: "m"})
+	}
+	return resp, nil
+}
+
+func TestWorkerIgnoresCancelledRecipients(t *testing.T) {
+	openTestDB(t)
+
+	partly, _, err := SaveNotification(Notification{Message: "m", Tokens: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	all, _, err := SaveNotification(Notification{Message: "m", Tokens: []string{"c", "d"}})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+
+	if _, err := CancelRecipients(partly, []string{"b"}); err != nil {
+		t.Fatalf("CancelRecipients: %v", err)
+	}
+	if _, err := CancelRecipients(all, []string{"c", "d"}); err != nil {
+		t.Fatalf("CancelRecipients: %v", err)
+	}
+
+	runWorker(t, sendAll)
+
+	for id, want := range map[uint]Status{partly: StatusSent, all: StatusCancelled} {
+		var n Notification
+		db.First(&n, id)
+		if n.Status != want || !n.Processed || n.LastError != "" {
+			t.Errorf("notification %d is %s processed=%v error=%q, want %s", id, n.Status, n.Processed, n.LastError, want)
+		}
+	}
+}
+
+func TestWorkerBacksOffWhenDevicesCannotBeLoaded(t *testing.T) {
+	openTestDB(t)
+
+	id, _, err := SaveNotification(Notification{Message: "m", UserIDs: "u1"})
+	if err != nil {
+		t.Fatalf("SaveNotification: %v", err)
+	}
+	if err := db.Migrator().DropTable(&Device{}); err != nil {
+		t.Fatal(err)
+	}
+
+	runWorker(t, sendAll)
+
+	var n Notification
+	db.First(&n, id)
+	if n.Processing || n.Processed || n.Attempts != 1 || n.NextAttemptAt == nil || !n.NextAttemptAt.After(time.Now()) {
+		t.Errorf("notification is processing=%v processed=%v with %d attempts and next attempt %v, want a retry later",
+			n.Processing, n.Processed, n.Attempts, n.NextAttemptAt)
+	}
+
+	// Once out of attempts it is given up on instead of being requeued again
+	db.Model(&Notification{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"attempts":        retryPolicy.MaxAttempts - 1,
+		"next_attempt_at": nil,
+	})
+	runWorker(t, sendAll)
+
+	db.First(&n, id)
+	if !n.Processed || n.Processing || n.LastError == "" {
+		t.Errorf("notification is processing=%v processed=%v with error %q, want it finished with the error",
+			n.Processing, n.Processed, n.LastError)
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/notification"
+	pb "go-noti-server/protos/notifications"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxBatchNotifications = 1000
+
+func (s *server) SendMessages(ctx context.Context, req *pb.SendMessagesRequest) (*pb.SendMessagesResponse, error) {
+	startTime := time.Now()
+
+	if s.draining.Load() {
+		return nil, status.Errorf(codes.Unavailable, "Server is shutting down")
+	}
+
+	if len(req.GetNotifications()) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "No notifications")
+	}
+	if len(req.GetNotifications()) > maxBatchNotifications {
+		return nil, status.Errorf(codes.InvalidArgument, "At most %d notifications per batch", maxBatchNotifications)
+	}
+
+	results, accepted, err := saveBatch(req.GetNotifications(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	log.InfoLogger.Printf("Batch of %d notifications, %d accepted, Request Time taken: %v",
+		len(req.GetNotifications()), accepted, time.Since(startTime))
+
+	return &pb.SendMessagesResponse{Results: results}, nil
+}
+
+// saveBatch validates and saves notifications in one transaction. Result indexes start at offset.
+// Invalid notifications are reported in their result; err is only set when saving failed.
+func saveBatch(items []*pb.NotificationRequest, offset int) (results []*pb.SendMessageResult, accepted int, err error) {
+	var (
+		toSave   []notification.Notification
+		saveFrom []int
+	)
+	results = make([]*pb.SendMessageResult, len(items))
+
+	for i, item := range items {
+		result := &pb.SendMessageResult{Index: int32(offset + i)}
+		results[i] = result
+
+		n, suppressed, err := newNotification(item)
+		result.SuppressedTokens = suppressed
+		switch {
+		case err != nil:
+			result.Error = status.Convert(err).Message()
+		case n == nil:
+			result.Error = "All device tokens are dead"
+		default:
+			toSave = append(toSave, *n)
+			saveFrom = append(saveFrom, i)
+		}
+	}
+
+	if len(toSave) == 0 {
+		return results, 0, nil
+	}
+
+	saved, err := notification.SaveNotifications(toSave)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to save %d notifications: %v", len(toSave), err)
+		return nil, 0, status.Errorf(codes.Internal, "Failed to save notifications")
+	}
+
+	for j, r := range saved {
+		result := results[saveFrom[j]]
+		result.Accepted = true
+		result.Id = uint64(r.ID)
+		result.Duplicate = r.Duplicate
+	}
+	return results, len(saved), nil
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+
+	"go-noti-server/internal/cleanup"
+	"go-noti-server/internal/log"
+	pb "go-noti-server/protos/notifications"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *server) DryRunCleanup(ctx context.Context, req *pb.DryRunCleanupRequest) (*pb.CleanupReport, error) {
+	report, err := cleanup.DryRun(s.retention)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to dry run cleanup: %v", err)
+		return nil, status.Errorf(codes.Internal, "Failed to dry run cleanup")
+	}
+
+	resp := &pb.CleanupReport{IdempotencyKeys: report.IdempotencyKeys}
+	for _, rule := range report.Rules {
+		resp.Rules = append(resp.Rules, &pb.RetentionRule{
+			State:            notificationStates[rule.Status],
+			RetentionSeconds: int64(rule.Retention.Seconds()),
+			Cutoff:           timestamppb.New(rule.Cutoff),
+			Notifications:    rule.Notifications,
+			Deliveries:       rule.Deliveries,
+			Recipients:       rule.Recipients,
+			IdempotencyKeys:  rule.IdempotencyKeys,
+		})
+	}
+	return resp, nil
+}
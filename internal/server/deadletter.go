@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/notification"
+	pb "go-noti-server/protos/notifications"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultDeadLetterLimit = 50
+	maxDeadLetterLimit     = 500
+)
+
+func (s *server) ListDeadLetters(ctx context.Context, req *pb.ListDeadLettersRequest) (*pb.ListDeadLettersResponse, error) {
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultDeadLetterLimit
+	}
+	if limit > maxDeadLetterLimit {
+		limit = maxDeadLetterLimit
+	}
+
+	deadLetters, total, err := notification.FetchDeadLetters(limit, int(req.GetOffset()), req.GetIncludeReplayed())
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to list dead letters: %v", err)
+		return nil, status.Errorf(codes.Internal, "Failed to list dead letters")
+	}
+
+	resp := &pb.ListDeadLettersResponse{Total: total}
+	for _, d := range deadLetters {
+		resp.DeadLetters = append(resp.DeadLetters, deadLetterToProto(d))
+	}
+	return resp, nil
+}
+
+func (s *server) GetDeadLetter(ctx context.Context, req *pb.GetDeadLetterRequest) (*pb.DeadLetter, error) {
+	deadLetter, err := notification.FetchDeadLetter(uint(req.GetId()))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Dead letter %d not found", req.GetId())
+	}
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to fetch dead letter %d: %v", req.GetId(), err)
+		return nil, status.Errorf(codes.Internal, "Failed to fetch dead letter")
+	}
+
+	return deadLetterToProto(deadLetter), nil
+}
+
+func (s *server) ReplayDeadLetters(ctx context.Context, req *pb.ReplayDeadLettersRequest) (*pb.ReplayDeadLettersResponse, error) {
+	if len(req.GetIds()) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "No dead letter ids")
+	}
+
+	resp := &pb.ReplayDeadLettersResponse{}
+	for _, id := range req.GetIds() {
+		result := &pb.ReplayResult{Id: id}
+
+		notificationID, err := notification.ReplayDeadLetter(uint(id))
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			result.Error = "not found"
+		case errors.Is(err, notification.ErrNotificationInFlight):
+			result.Error = fmt.Sprintf("notification of dead letter %d is being sent, replay it once it finishes", id)
+		case errors.Is(err, notification.ErrNotificationCancelled):
+			result.Error = fmt.Sprintf("notification of dead letter %d was cancelled", id)
+		case err != nil:
+			log.ErrorLogger.Printf("Failed to replay dead letter %d: %v", id, err)
+			result.Error = err.Error()
+		default:
+			log.InfoLogger.Printf("Replayed dead letter %d as notification %d", id, notificationID)
+			result.NotificationId = uint64(notificationID)
+		}
+
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+func (s *server) PurgeDeadLetters(ctx context.Context, req *pb.PurgeDeadLettersRequest) (*pb.PurgeDeadLettersResponse, error) {
+	var olderThan time.Time
+	if req.GetOlderThan() != nil {
+		olderThan = req.GetOlderThan().AsTime()
+	}
+
+	if len(req.GetIds()) == 0 && olderThan.IsZero() {
+		return nil, status.Errorf(codes.InvalidArgument, "Either ids or olderThan is required")
+	}
+
+	ids := make([]uint, 0, len(req.GetIds()))
+	for _, id := range req.GetIds() {
+		ids = append(ids, uint(id))
+	}
+
+	purged, err := notification.PurgeDeadLetters(ids, olderThan)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to purge dead letters: %v", err)
+		return nil, status.Errorf(codes.Internal, "Failed to purge dead letters")
+	}
+
+	log.InfoLogger.Printf("Purged %d dead letters", purged)
+	return &pb.PurgeDeadLettersResponse{Purged: purged}, nil
+}
+
+func deadLetterToProto(d notification.DeadLetter) *pb.DeadLetter {
+	deadLetter := &pb.DeadLetter{
+		Id:             uint64(d.ID),
+		NotificationId: uint64(d.NotificationID),
+		Notification: &pb.NotificationPackage{
+			Message:        d.Message,
+			DeviceTokens:   splitTokens(d.DeviceTokens),
+			Topic:          d.Topic,
+			Condition:      d.Condition,
+			AnalyticsLabel: d.AnalyticsLabel,
+			Title:          d.Title,
+			Body:           d.Body,
+			Image:          d.Image,
+			Data:           notification.ParseData(d.Data),
+		},
+		Attempts:             int32(d.Attempts),
+		LastError:            d.LastError,
+		ErrorCode:            d.ErrorCode,
+		CreatedAt:            timestamppb.New(d.CreatedAt),
+		ReplayNotificationId: uint64(d.ReplayNotificationID),
+	}
+
+	setOverrides(deadLetter.Notification, d.Overrides)
+
+	if d.ReplayedAt != nil {
+		deadLetter.ReplayedAt = timestamppb.New(*d.ReplayedAt)
+	}
+
+	for _, a := range d.AttemptHistory() {
+		deadLetter.History = append(deadLetter.History, &pb.DeadLetterAttempt{
+			Attempt:      int32(a.Attempt),
+			SentAt:       timestamppb.New(a.SentAt),
+			SuccessCount: int32(a.SuccessCount),
+			FailureCount: int32(a.FailureCount),
+			Error:        a.Error,
+		})
+	}
+	return deadLetter
+}
+
+func splitTokens(tokens string) []string {
+	if tokens == "" {
+		return nil
+	}
+	return strings.Split(tokens, ",")
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/notification"
+	pb "go-noti-server/protos/notifications"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+func (s *server) RegisterDevice(ctx context.Context, req *pb.Device) (*pb.Device, error) {
+	if req.GetUserId() == "" || req.GetToken() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "userId and token are required")
+	}
+
+	device := deviceFromProto(req)
+	if err := notification.RegisterDevice(&device); err != nil {
+		log.ErrorLogger.Printf("Failed to register device of user %s: %v", req.GetUserId(), err)
+		return nil, status.Errorf(codes.Internal, "Failed to register device")
+	}
+
+	return deviceToProto(device), nil
+}
+
+func (s *server) UpdateDevice(ctx context.Context, req *pb.Device) (*pb.Device, error) {
+	if req.GetToken() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "token is required")
+	}
+
+	device, err := notification.UpdateDevice(deviceFromProto(req))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Device not found")
+	}
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to update device: %v", err)
+		return nil, status.Errorf(codes.Internal, "Failed to update device")
+	}
+
+	return deviceToProto(device), nil
+}
+
+func (s *server) RemoveDevices(ctx context.Context, req *pb.RemoveDevicesRequest) (*pb.RemoveDevicesResponse, error) {
+	if req.GetUserId() == "" && req.GetToken() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "userId or token is required")
+	}
+
+	removed, err := notification.RemoveDevices(req.GetUserId(), req.GetToken())
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to remove devices of user %s: %v", req.GetUserId(), err)
+		return nil, status.Errorf(codes.Internal, "Failed to remove devices")
+	}
+
+	return &pb.RemoveDevicesResponse{Removed: removed}, nil
+}
+
+func (s *server) ListDevices(ctx context.Context, req *pb.ListDevicesRequest) (*pb.ListDevicesResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "userId is required")
+	}
+
+	devices, err := notification.FetchDevices(req.GetUserId())
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to list devices of user %s: %v", req.GetUserId(), err)
+		return nil, status.Errorf(codes.Internal, "Failed to list devices")
+	}
+
+	resp := &pb.ListDevicesResponse{}
+	for _, d := range devices {
+		resp.Devices = append(resp.Devices, deviceToProto(d))
+	}
+	return resp, nil
+}
+
+func deviceFromProto(d *pb.Device) notification.Device {
+	device := notification.Device{
+		UserID:     d.GetUserId(),
+		Token:      d.GetToken(),
+		Platform:   d.GetPlatform(),
+		AppVersion: d.GetAppVersion(),
+		Locale:     d.GetLocale(),
+		Timezone:   d.GetTimezone(),
+	}
+	if d.GetLastSeenAt() != nil {
+		device.LastSeenAt = d.GetLastSeenAt().AsTime()
+	}
+	return device
+}
+
+func deviceToProto(d notification.Device) *pb.Device {
+	return &pb.Device{
+		UserId:     d.UserID,
+		Token:      d.Token,
+		Platform:   d.Platform,
+		AppVersion: d.AppVersion,
+		Locale:     d.Locale,
+		Timezone:   d.Timezone,
+		LastSeenAt: timestamppb.New(d.LastSeenAt),
+		CreatedAt:  timestamppb.New(d.CreatedAt),
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"time"
+
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/notification"
+	pb "go-noti-server/protos/notifications"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	deliveryEventPage = 500
+	// Deliveries saved by another replica do not wake this one up, so poll as well
+	deliveryEventPoll = 5 * time.Second
+)
+
+// WatchDeliveryEvents streams delivery outcomes as workers record them. Every event carries a
+// cursor; reconnecting with the last cursor seen resumes without losing events, as long as they
+// have not been cleaned up yet. Events mostly arrive in delivery order, but one whose transaction
+// committed late is sent when it shows up.
+func (s *server) WatchDeliveryEvents(req *pb.WatchDeliveryEventsRequest, stream pb.NotificationService_WatchDeliveryEventsServer) error {
+	var (
+		cursor notification.EventCursor
+		err    error
+	)
+	if req.GetCursor() != "" {
+		cursor, err = notification.ParseEventCursor(req.GetCursor())
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "Invalid cursor")
+		}
+	} else {
+		cursor, err = notification.LatestDeliveryCursor()
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to read latest delivery cursor: %v", err)
+			return status.Errorf(codes.Internal, "Failed to read delivery events")
+		}
+	}
+
+	filter := notification.DeliveryEventFilter{
+		NotificationID: uint(req.GetNotificationId()),
+		AnalyticsLabel: req.GetAnalyticsLabel(),
+		Tenant:         req.GetTenant(),
+	}
+
+	for {
+		updated := notification.DeliveryUpdates()
+
+		events, more, err := notification.FetchDeliveryEvents(&cursor, filter, deliveryEventPage)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to read delivery events: %v", err)
+			return status.Errorf(codes.Internal, "Failed to read delivery events")
+		}
+
+		for _, e := range events {
+			if err := stream.Send(deliveryEventToProto(e)); err != nil {
+				return err
+			}
+		}
+
+		if more {
+			continue
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.stopping:
+			return status.Errorf(codes.Unavailable, "Server is shutting down")
+		case <-updated:
+		case <-time.After(deliveryEventPoll):
+		}
+	}
+}
+
+func deliveryEventToProto(e notification.DeliveryEvent) *pb.DeliveryEvent {
+	event := &pb.DeliveryEvent{
+		Cursor:         e.Cursor,
+		Type:           pb.DeliveryEventType_DELIVERY_SENT,
+		NotificationId: uint64(e.NotificationID),
+		Token:          e.Token,
+		Attempt:        int32(e.Attempt),
+		MessageId:      e.MessageID,
+		ErrorCode:      e.ErrorCode,
+		Error:          e.Error,
+		SentAt:         timestamppb.New(e.SentAt),
+		AnalyticsLabel: e.AnalyticsLabel,
+		Tenant:         e.Tenant,
+	}
+
+	switch {
+	case e.IsDeadToken():
+		event.Type = pb.DeliveryEventType_TOKEN_INVALID
+	case !e.Success:
+		event.Type = pb.DeliveryEventType_DELIVERY_FAILED
+	}
+	return event
+}
@@ -6,8 +6,11 @@ import (
 	"net"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"go-noti-server/internal/cleanup"
+	"go-noti-server/internal/dispatcher"
 	"go-noti-server/internal/log"
 	"go-noti-server/internal/notification"
 	pbh "go-noti-server/protos/health"
@@ -21,77 +24,258 @@ import (
 
 type server struct {
 	pb.UnimplementedNotificationServiceServer
+	dispatcher *dispatcher.Dispatcher
+	pool       *notification.Pool
+	draining   atomic.Bool
+	stopping   chan struct{}
+
+	streamBatchSize     int
+	streamFlushInterval time.Duration
+
+	retention cleanup.Policy
+}
+
+// Options holds the components the gRPC services report on and manage
+type Options struct {
+	Dispatcher *dispatcher.Dispatcher
+	Pool       *notification.Pool
+
+	// How StreamMessages batches writes, defaults to 100 notifications or 500ms
+	StreamBatchSize     int
+	StreamFlushInterval time.Duration
+
+	// The policy DryRunCleanup reports on, the same one the daily cleanup runs
+	Retention cleanup.Policy
 }
 
 type healthCheckServer struct {
 	pbh.UnimplementedHealthServiceServer
 }
 
-func RunGrpcServer() {
+// GrpcServer is a running gRPC server that can be drained on shutdown
+type GrpcServer struct {
+	grpc    *grpc.Server
+	service *server
+}
+
+// RunGrpcServer starts serving on PORT in the background
+func RunGrpcServer(opts Options) (*GrpcServer, error) {
+	port := os.Getenv("PORT")
+
+	lis, err := net.Listen("tcp", port)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.StreamBatchSize <= 0 {
+		opts.StreamBatchSize = 100
+	}
+	if opts.StreamFlushInterval <= 0 {
+		opts.StreamFlushInterval = 500 * time.Millisecond
+	}
+
 	var (
-		port     = os.Getenv("PORT")
-		lis, err = net.Listen("tcp", port)
-		s        = grpc.NewServer(grpc.UnaryInterceptor(AuthInterceptor))
+		s = grpc.NewServer(
+			grpc.UnaryInterceptor(AuthInterceptor),
+			grpc.StreamInterceptor(StreamAuthInterceptor),
+		)
+		service = &server{
+			dispatcher:          opts.Dispatcher,
+			pool:                opts.Pool,
+			stopping:            make(chan struct{}),
+			streamBatchSize:     opts.StreamBatchSize,
+			streamFlushInterval: opts.StreamFlushInterval,
+			retention:           opts.Retention,
+		}
 	)
 
-	pb.RegisterNotificationServiceServer(s, &server{})
+	pb.RegisterNotificationServiceServer(s, service)
 	pbh.RegisterHealthServiceServer(s, &healthCheckServer{})
 
 	log.InfoLogger.Printf("server listening at %v\n", lis.Addr())
-	log.InfoLogger.Printf("server listening at %v\n", lis.Addr())
-	log.InfoLogger.Printf("Hello")
 
-	if err != nil {
-		log.ErrorLogger.Fatalf("Failed to listen: %v", err)
-	}
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.ErrorLogger.Fatalf("failed to serve: %v", err)
+		}
+	}()
+
+	return &GrpcServer{grpc: s, service: service}, nil
+}
+
+// Shutdown rejects new notifications and waits for in-flight RPCs to finish. RPCs still running
+// when ctx expires are cancelled.
+func (g *GrpcServer) Shutdown(ctx context.Context) {
+	g.service.draining.Store(true)
+	close(g.service.stopping)
+
+	stopped := make(chan struct{})
+	go func() {
+		g.grpc.GracefulStop()
+		close(stopped)
+	}()
 
-	if err := s.Serve(lis); err != nil {
-		log.ErrorLogger.Fatalf("failed to serve: %v", err)
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.ErrorLogger.Printf("gRPC server did not drain in time, stopping")
+		g.grpc.Stop()
 	}
 }
 
 func (s *server) SendMessage(ctx context.Context, req *pb.NotificationRequest) (*pb.NotificationResponse, error) {
 	startTime := time.Now()
 
+	if s.draining.Load() {
+		return nil, status.Errorf(codes.Unavailable, "Server is shutting down")
+	}
+
+	notificationData, suppressed, err := newNotification(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if notificationData == nil {
+		return &pb.NotificationResponse{Message: "All device tokens are dead", SuppressedTokens: suppressed}, nil
+	}
+
+	id, duplicate, err := notification.SaveNotification(*notificationData)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to save notification: %v", err)
+		return nil, status.Errorf(codes.Internal, "Failed to save notification")
+	}
+
+	log.InfoLogger.Printf(
+		"Message: %s, Title: %s, Body: %s, Image: %s, Data: %+v",
+		notificationData.Message, notificationData.Title, notificationData.Body,
+		notificationData.Image, notificationData.Data,
+	)
+
+	endTime := time.Now()
+	duration := endTime.Sub(startTime)
+
+	log.InfoLogger.Printf("Request Time taken: %v\n", duration)
+
+	if duplicate {
+		log.InfoLogger.Printf("Idempotency key %q replayed, returning notification %d", req.GetIdempotencyKey(), id)
+		return &pb.NotificationResponse{Message: "Duplicate", SuppressedTokens: suppressed, Id: uint64(id), Duplicate: true}, nil
+	}
+
+	return &pb.NotificationResponse{Message: "Message Received", SuppressedTokens: suppressed, Id: uint64(id)}, nil
+}
+
+// newNotification validates a request and turns it into a notification ready to be saved. Tokens
+// known to be dead are dropped and returned separately; when none are left the notification is nil.
+// Errors are gRPC statuses.
+func newNotification(req *pb.NotificationRequest) (*notification.Notification, []string, error) {
 	if req.GetNotification() == nil {
 		log.InfoLogger.Println("Caught it")
-		return nil, status.Errorf(codes.InvalidArgument, "Empty Message")
+		return nil, nil, status.Errorf(codes.InvalidArgument, "Empty Message")
+	}
+
+	deviceTokens, suppressed, err := notification.FilterDeadTokens(req.GetNotification().DeviceTokens)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to check device tokens: %v", err)
+		return nil, nil, status.Errorf(codes.Internal, "Failed to check device tokens")
+	}
+
+	if len(suppressed) > 0 {
+		log.InfoLogger.Printf("Suppressed %d dead device tokens", len(suppressed))
+	}
+
+	hasTargets := req.GetNotification().Topic != "" || req.GetNotification().Condition != "" || len(req.GetNotification().UserIds) > 0
+	if len(deviceTokens) == 0 && len(suppressed) > 0 && !hasTargets {
+		return nil, suppressed, nil
 	}
 
 	data, err := json.Marshal(req.GetNotification().Data)
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to serialize data: %v", err)
-		return nil, status.Errorf(codes.Internal, "Failed to serialize data")
+		return nil, nil, status.Errorf(codes.Internal, "Failed to serialize data")
 	}
 
-	notificationData := notification.Notification{
+	overrides, err := overridesFromProto(req.GetNotification())
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	topic := strings.TrimPrefix(req.GetNotification().Topic, "/topics/")
+	if topic != "" {
+		if err := notification.ValidateTopic(topic); err != nil {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+	}
+	if condition := req.GetNotification().Condition; condition != "" {
+		if err := notification.ValidateCondition(condition); err != nil {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+	}
+
+	notificationData := &notification.Notification{
 		Message:        req.GetNotification().Message,
 		Title:          req.GetNotification().Title,
 		Body:           req.GetNotification().Body,
 		Image:          req.GetNotification().Image,
-		DeviceTokens:   strings.Join(req.GetNotification().DeviceTokens, ","),
+		Tokens:         deviceTokens,
 		AnalyticsLabel: req.GetNotification().AnalyticsLabel,
 		Data:           string(data),
+		Overrides:      overrides,
+		IdempotencyKey: req.GetIdempotencyKey(),
+		Tenant:         req.GetNotification().Tenant,
+		Topic:          topic,
+		Condition:      req.GetNotification().Condition,
+		UserIDs:        strings.Join(req.GetNotification().UserIds, ","),
 	}
 
-	err = notification.SaveNotification(notificationData)
+	if sendAt := req.GetNotification().GetSendAt(); sendAt != nil && sendAt.AsTime().After(time.Now()) {
+		at := sendAt.AsTime()
+		notificationData.SendAt = &at
+	}
+
+	return notificationData, suppressed, nil
+}
+
+func (s *server) GetQueueStats(ctx context.Context, req *pb.QueueStatsRequest) (*pb.QueueStatsResponse, error) {
+	if s.dispatcher == nil {
+		return nil, status.Errorf(codes.Unavailable, "Dispatcher not running")
+	}
+
+	stats, err := s.dispatcher.Stats()
 	if err != nil {
-		log.ErrorLogger.Printf("Failed to save notification: %v", err)
-		return nil, status.Errorf(codes.Internal, "Failed to save notification")
+		log.ErrorLogger.Printf("Failed to read queue stats: %v", err)
+		return nil, status.Errorf(codes.Internal, "Failed to read queue stats")
 	}
 
-	log.InfoLogger.Printf(
-		"Message: %s, Title: %s, Body: %s, Image: %s, Data: %+v",
-		notificationData.Message, notificationData.Title, notificationData.Body,
-		notificationData.Image, string(data),
-	)
+	return &pb.QueueStatsResponse{
+		Due:            stats.Due,
+		Delayed:        stats.Delayed,
+		Scheduled:      stats.Scheduled,
+		Leased:         stats.Leased,
+		Buffered:       int32(stats.Buffered),
+		BufferCapacity: int32(stats.BufferCapacity),
+	}, nil
+}
 
-	endTime := time.Now()
-	duration := endTime.Sub(startTime)
+func (s *server) GetWorkerPool(ctx context.Context, req *pb.WorkerPoolRequest) (*pb.WorkerPoolResponse, error) {
+	if s.pool == nil {
+		return nil, status.Errorf(codes.Unavailable, "Worker pool not running")
+	}
 
-	log.InfoLogger.Printf("Request Time taken: %v\n", duration)
+	return &pb.WorkerPoolResponse{Size: int32(s.pool.Size()), MaxSize: int32(s.pool.MaxSize())}, nil
+}
+
+func (s *server) ScaleWorkerPool(ctx context.Context, req *pb.ScaleWorkerPoolRequest) (*pb.WorkerPoolResponse, error) {
+	if s.pool == nil {
+		return nil, status.Errorf(codes.Unavailable, "Worker pool not running")
+	}
+
+	previous := s.pool.Size()
+	if err := s.pool.Resize(int(req.GetSize())); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
 
-	return &pb.NotificationResponse{Message: "Message Received"}, nil
+	log.InfoLogger.Printf("Scaled worker pool from %d to %d", previous, req.GetSize())
+	return &pb.WorkerPoolResponse{Size: int32(s.pool.Size()), MaxSize: int32(s.pool.MaxSize())}, nil
 }
 
 func (s *healthCheckServer) Check(ctx context.Context, req *pbh.HealthCheckRequest) (*pbh.HealthCheckResponse, error) {
@@ -111,6 +295,15 @@ func AuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServe
 	return handler(ctx, req)
 }
 
+func StreamAuthInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	token := extractFromContext(ss.Context())
+	log.InfoLogger.Println("stream auth intercept")
+	if !isTokenValid(token) {
+		return status.Errorf(codes.Unauthenticated, "Token invalid")
+	}
+	return handler(srv, ss)
+}
+
 func extractFromContext(ctx context.Context) string {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/notification"
+	pb "go-noti-server/protos/notifications"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+func (s *server) GetRecipientHistory(ctx context.Context, req *pb.RecipientHistoryRequest) (*pb.RecipientHistoryResponse, error) {
+	if (req.GetTarget() == "") == (req.GetUserId() == "") {
+		return nil, status.Errorf(codes.InvalidArgument, "Exactly one of target or userId is required")
+	}
+
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	targets := []string{req.GetTarget()}
+	if req.GetUserId() != "" {
+		devices, err := notification.FetchDevices(req.GetUserId())
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to list devices of user %s: %v", req.GetUserId(), err)
+			return nil, status.Errorf(codes.Internal, "Failed to fetch recipient history")
+		}
+
+		targets = targets[:0]
+		for _, d := range devices {
+			targets = append(targets, d.Token)
+		}
+	}
+
+	recipients, err := notification.FetchRecipientsForTargets(targets, uint(req.GetNotificationId()), limit)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to fetch recipient history: %v", err)
+		return nil, status.Errorf(codes.Internal, "Failed to fetch recipient history")
+	}
+
+	deliveries, err := notification.FetchDeliveriesForRecipients(recipients)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to fetch delivery history: %v", err)
+		return nil, status.Errorf(codes.Internal, "Failed to fetch recipient history")
+	}
+
+	type recipientKey struct {
+		notificationID uint
+		target         string
+	}
+	attempts := map[recipientKey][]*pb.DeliveryAttempt{}
+	for _, d := range deliveries {
+		key := recipientKey{d.NotificationID, d.Token}
+		attempts[key] = append(attempts[key], &pb.DeliveryAttempt{
+			Attempt:   int32(d.Attempt),
+			Success:   d.Success,
+			MessageId: d.MessageID,
+			ErrorCode: d.ErrorCode,
+			Error:     d.Error,
+			SentAt:    timestamppb.New(d.SentAt),
+		})
+	}
+
+	resp := &pb.RecipientHistoryResponse{}
+	for _, r := range recipients {
+		resp.Recipients = append(resp.Recipients, &pb.RecipientHistory{
+			NotificationId: uint64(r.NotificationID),
+			Target:         r.Target,
+			State:          recipientStates[r.Status],
+			Attempts:       int32(r.Attempts),
+			MessageId:      r.MessageID,
+			ErrorCode:      r.ErrorCode,
+			LastError:      r.LastError,
+			CreatedAt:      timestamppb.New(r.CreatedAt),
+			UpdatedAt:      timestamppb.New(r.UpdatedAt),
+			Deliveries:     attempts[recipientKey{r.NotificationID, r.Target}],
+		})
+	}
+	return resp, nil
+}
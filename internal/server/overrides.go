@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go-noti-server/internal/notification"
+	pb "go-noti-server/protos/notifications"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// overridesFromProto validates the per-platform overrides of a notification and encodes them for
+// storage. It returns an empty string when none are set.
+func overridesFromProto(n *pb.NotificationPackage) (string, error) {
+	var overrides notification.PlatformOverrides
+
+	if a := n.GetAndroid(); a != nil {
+		if a.Priority != "" && a.Priority != "normal" && a.Priority != "high" {
+			return "", fmt.Errorf("android priority must be normal or high")
+		}
+		if a.Color != "" && !colorPattern.MatchString(a.Color) {
+			return "", fmt.Errorf("android color must be in #rrggbb format")
+		}
+		if a.TtlSeconds < 0 {
+			return "", fmt.Errorf("android ttlSeconds must not be negative")
+		}
+		overrides.Android = &notification.AndroidOverrides{
+			Priority:    a.Priority,
+			TTLSeconds:  a.TtlSeconds,
+			Sound:       a.Sound,
+			Badge:       optionalInt(a.Badge),
+			ClickAction: a.ClickAction,
+			Tag:         a.Tag,
+			Color:       a.Color,
+			ChannelID:   a.ChannelId,
+		}
+	}
+
+	if a := n.GetApns(); a != nil {
+		if a.Priority != "" && a.Priority != "5" && a.Priority != "10" {
+			return "", fmt.Errorf("apns priority must be 5 or 10")
+		}
+		if a.TtlSeconds < 0 {
+			return "", fmt.Errorf("apns ttlSeconds must not be negative")
+		}
+		overrides.APNS = &notification.APNSOverrides{
+			Priority:         a.Priority,
+			TTLSeconds:       a.TtlSeconds,
+			Sound:            a.Sound,
+			Badge:            optionalInt(a.Badge),
+			Category:         a.Category,
+			ThreadID:         a.ThreadId,
+			MutableContent:   a.MutableContent,
+			ContentAvailable: a.ContentAvailable,
+		}
+	}
+
+	if w := n.GetWebpush(); w != nil {
+		switch w.Urgency {
+		case "", "very-low", "low", "normal", "high":
+		default:
+			return "", fmt.Errorf("webpush urgency must be very-low, low, normal or high")
+		}
+		if w.TtlSeconds < 0 {
+			return "", fmt.Errorf("webpush ttlSeconds must not be negative")
+		}
+		if w.Link != "" && !strings.HasPrefix(w.Link, "https://") {
+			return "", fmt.Errorf("webpush link must be an https URL")
+		}
+		overrides.Webpush = &notification.WebpushOverrides{
+			Urgency:    w.Urgency,
+			TTLSeconds: w.TtlSeconds,
+			Link:       w.Link,
+			Tag:        w.Tag,
+			Icon:       w.Icon,
+			Badge:      w.Badge,
+		}
+	}
+
+	if overrides == (notification.PlatformOverrides{}) {
+		return "", nil
+	}
+
+	encoded, err := json.Marshal(overrides)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// setOverrides copies stored overrides back onto a notification package
+func setOverrides(n *pb.NotificationPackage, stored string) {
+	overrides := notification.ParseOverrides(stored)
+
+	if a := overrides.Android; a != nil {
+		n.Android = &pb.AndroidOverrides{
+			Priority:    a.Priority,
+			TtlSeconds:  a.TTLSeconds,
+			Sound:       a.Sound,
+			Badge:       optionalInt32(a.Badge),
+			ClickAction: a.ClickAction,
+			Tag:         a.Tag,
+			Color:       a.Color,
+			ChannelId:   a.ChannelID,
+		}
+	}
+
+	if a := overrides.APNS; a != nil {
+		n.Apns = &pb.APNSOverrides{
+			Priority:         a.Priority,
+			TtlSeconds:       a.TTLSeconds,
+			Sound:            a.Sound,
+			Badge:            optionalInt32(a.Badge),
+			Category:         a.Category,
+			ThreadId:         a.ThreadID,
+			MutableContent:   a.MutableContent,
+			ContentAvailable: a.ContentAvailable,
+		}
+	}
+
+	if w := overrides.Webpush; w != nil {
+		n.Webpush = &pb.WebpushOverrides{
+			Urgency:    w.Urgency,
+			TtlSeconds: w.TTLSeconds,
+			Link:       w.Link,
+			Tag:        w.Tag,
+			Icon:       w.Icon,
+			Badge:      w.Badge,
+		}
+	}
+}
+
+func optionalInt(v *int32) *int {
+	if v == nil {
+		return nil
+	}
+	i := int(*v)
+	return &i
+}
+
+func optionalInt32(v *int) *int32 {
+	if v == nil {
+		return nil
+	}
+	i := int32(*v)
+	return &i
+}
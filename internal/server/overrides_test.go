@@ -0,0 +1,75 @@
+package server
+
+import (
+	"testing"
+
+	pb "go-noti-server/protos/notifications"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOverridesFromProtoValidates(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       *pb.NotificationPackage
+		wantErr bool
+	}{
+		{"none", &pb.NotificationPackage{}, false},
+		{"android priority", &pb.NotificationPackage{Android: &pb.AndroidOverrides{Priority: "urgent"}}, true},
+		{"android color", &pb.NotificationPackage{Android: &pb.AndroidOverrides{Color: "red"}}, true},
+		{"android short color", &pb.NotificationPackage{Android: &pb.AndroidOverrides{Color: "#fff"}}, true},
+		{"android ttl", &pb.NotificationPackage{Android: &pb.AndroidOverrides{TtlSeconds: -1}}, true},
+		{"android valid", &pb.NotificationPackage{Android: &pb.AndroidOverrides{Priority: "normal", Color: "#A0b1C2"}}, false},
+		{"apns priority", &pb.NotificationPackage{Apns: &pb.APNSOverrides{Priority: "1"}}, true},
+		{"apns ttl", &pb.NotificationPackage{Apns: &pb.APNSOverrides{TtlSeconds: -1}}, true},
+		{"apns valid", &pb.NotificationPackage{Apns: &pb.APNSOverrides{Priority: "5"}}, false},
+		{"webpush urgency", &pb.NotificationPackage{Webpush: &pb.WebpushOverrides{Urgency: "urgent"}}, true},
+		{"webpush ttl", &pb.NotificationPackage{Webpush: &pb.WebpushOverrides{TtlSeconds: -1}}, true},
+		{"webpush http link", &pb.NotificationPackage{Webpush: &pb.WebpushOverrides{Link: "http://example.com"}}, true},
+		{"webpush relative link", &pb.NotificationPackage{Webpush: &pb.WebpushOverrides{Link: "/inbox"}}, true},
+		{"webpush valid", &pb.NotificationPackage{Webpush: &pb.WebpushOverrides{Urgency: "very-low", Link: "https://example.com"}}, false},
+	}
+	for _, tt := range tests {
+		_, err := overridesFromProto(tt.n)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestOverridesFromProtoRoundTrip(t *testing.T) {
+	if stored, err := overridesFromProto(&pb.NotificationPackage{}); err != nil || stored != "" {
+		t.Errorf("got %q without overrides: %v, want an empty string", stored, err)
+	}
+
+	in := &pb.NotificationPackage{
+		Android: &pb.AndroidOverrides{
+			Priority: "normal", TtlSeconds: 60, Sound: "chime", Badge: proto.Int32(2),
+			ClickAction: "OPEN", Tag: "t", Color: "#ff0000", ChannelId: "alerts",
+		},
+		Apns: &pb.APNSOverrides{
+			Priority: "5", TtlSeconds: 120, Sound: "chime.caf", Badge: proto.Int32(0),
+			Category: "REPLY", ThreadId: "chat-1", MutableContent: true, ContentAvailable: true,
+		},
+		Webpush: &pb.WebpushOverrides{
+			Urgency: "high", TtlSeconds: 30, Link: "https://example.com", Tag: "t", Icon: "/icon.png", Badge: "/badge.png",
+		},
+	}
+
+	stored, err := overridesFromProto(in)
+	if err != nil {
+		t.Fatalf("overridesFromProto: %v", err)
+	}
+
+	out := &pb.NotificationPackage{}
+	setOverrides(out, stored)
+	for name, pair := range map[string][2]proto.Message{
+		"android": {in.Android, out.Android},
+		"apns":    {in.Apns, out.Apns},
+		"webpush": {in.Webpush, out.Webpush},
+	} {
+		if !proto.Equal(pair[0], pair[1]) {
+			t.Errorf("%s overrides came back as %v, want %v", name, pair[1], pair[0])
+		}
+	}
+}
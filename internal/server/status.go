@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/notification"
+	pb "go-noti-server/protos/notifications"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+var notificationStates = map[notification.Status]pb.NotificationState{
+	notification.StatusQueued:          pb.NotificationState_QUEUED,
+	notification.StatusSending:         pb.NotificationState_SENDING,
+	notification.StatusSent:            pb.NotificationState_SENT,
+	notification.StatusPartiallyFailed: pb.NotificationState_PARTIALLY_FAILED,
+	notification.StatusFailed:          pb.NotificationState_FAILED,
+	notification.StatusCancelled:       pb.NotificationState_CANCELLED,
+}
+
+var recipientStates = map[notification.RecipientStatus]pb.RecipientState{
+	notification.RecipientPending:   pb.RecipientState_RECIPIENT_PENDING,
+	notification.RecipientSent:      pb.RecipientState_RECIPIENT_SENT,
+	notification.RecipientFailed:    pb.RecipientState_RECIPIENT_FAILED,
+	notification.RecipientDead:      pb.RecipientState_RECIPIENT_DEAD,
+	notification.RecipientCancelled: pb.RecipientState_RECIPIENT_CANCELLED,
+}
+
+func (s *server) GetNotificationStatus(ctx context.Context, req *pb.GetNotificationStatusRequest) (*pb.NotificationStatus, error) {
+	summary, err := notification.FetchNotificationStatus(uint(req.GetId()))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Notification %d not found", req.GetId())
+	}
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to fetch status of notification %d: %v", req.GetId(), err)
+		return nil, status.Errorf(codes.Internal, "Failed to fetch notification status")
+	}
+
+	n := summary.Notification
+	resp := &pb.NotificationStatus{
+		Id:          uint64(n.ID),
+		State:       notificationStates[n.Status],
+		Attempts:    int32(n.Attempts),
+		LastError:   n.LastError,
+		TotalTokens: int32(len(summary.Tokens)),
+		Succeeded:   int32(summary.Succeeded),
+		Failed:      int32(summary.Failed),
+		Pending:     int32(summary.Pending),
+		Cancelled:   int32(summary.Cancelled),
+		ErrorCodes:  map[string]int32{},
+		CreatedAt:   timestamppb.New(n.CreatedAt),
+		UpdatedAt:   timestamppb.New(n.UpdatedAt),
+	}
+	if n.NextAttemptAt != nil && !n.Processed {
+		resp.NextAttemptAt = timestamppb.New(*n.NextAttemptAt)
+	}
+	if n.SendAt != nil {
+		resp.SendAt = timestamppb.New(*n.SendAt)
+	}
+	if n.CancelledAt != nil {
+		resp.CancelledAt = timestamppb.New(*n.CancelledAt)
+		resp.CancelReason = n.CancelReason
+		resp.CancelledBy = n.CancelledBy
+	}
+	for code, count := range summary.ErrorCodes {
+		resp.ErrorCodes[code] = int32(count)
+	}
+
+	if req.GetIncludeTokens() {
+		for _, t := range summary.Tokens {
+			outcome := &pb.TokenOutcome{Token: t.Token, State: recipientStates[t.Status]}
+			if d := t.Delivery; d != nil {
+				outcome.Attempted = true
+				outcome.Success = d.Success
+				outcome.MessageId = d.MessageID
+				outcome.ErrorCode = d.ErrorCode
+				outcome.Error = d.Error
+				outcome.Attempt = int32(d.Attempt)
+				outcome.SentAt = timestamppb.New(d.SentAt)
+			}
+			resp.Tokens = append(resp.Tokens, outcome)
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *server) RescheduleNotification(ctx context.Context, req *pb.RescheduleNotificationRequest) (*pb.NotificationStatus, error) {
+	var sendAt *time.Time
+	if req.GetSendAt() != nil {
+		at := req.GetSendAt().AsTime()
+		sendAt = &at
+	}
+
+	if err := notification.RescheduleNotification(uint(req.GetId()), sendAt); err != nil {
+		return nil, waitingError(req.GetId(), "reschedule", err)
+	}
+
+	log.InfoLogger.Printf("Rescheduled notification %d to %v", req.GetId(), sendAt)
+	return s.GetNotificationStatus(ctx, &pb.GetNotificationStatusRequest{Id: req.GetId()})
+}
+
+func (s *server) CancelNotification(ctx context.Context, req *pb.CancelNotificationRequest) (*pb.NotificationStatus, error) {
+	caller := req.GetCaller()
+	if caller == "" {
+		caller = callerFromContext(ctx)
+	}
+
+	if len(req.GetTokens()) > 0 {
+		cancelled, err := notification.CancelRecipients(uint(req.GetId()), req.GetTokens())
+		switch {
+		case errors.Is(err, notification.ErrFinished):
+			return nil, status.Errorf(codes.FailedPrecondition, "Notification %d has already finished", req.GetId())
+		case err != nil:
+			return nil, waitingError(req.GetId(), "cancel", err)
+		}
+
+		log.InfoLogger.Printf("Cancelled %d tokens of notification %d by %s: %s", cancelled, req.GetId(), caller, req.GetReason())
+		return s.GetNotificationStatus(ctx, &pb.GetNotificationStatusRequest{Id: req.GetId()})
+	}
+
+	inFlight, err := notification.CancelNotification(uint(req.GetId()), req.GetReason(), caller)
+	switch {
+	case errors.Is(err, notification.ErrFinished):
+		return nil, status.Errorf(codes.FailedPrecondition, "Notification %d has already finished", req.GetId())
+	case err != nil:
+		return nil, waitingError(req.GetId(), "cancel", err)
+	}
+
+	log.InfoLogger.Printf("Cancelled notification %d (in flight: %v) by %s: %s", req.GetId(), inFlight, caller, req.GetReason())
+	return s.GetNotificationStatus(ctx, &pb.GetNotificationStatusRequest{Id: req.GetId()})
+}
+
+// callerFromContext identifies who made a request, from the x-caller metadata or the peer address
+func callerFromContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if callers := md.Get("x-caller"); len(callers) > 0 && callers[0] != "" {
+			return callers[0]
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// waitingError maps errors from changing a queued notification to gRPC statuses
+func waitingError(id uint64, action string, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Errorf(codes.NotFound, "Notification %d not found", id)
+	case errors.Is(err, notification.ErrNotWaiting):
+		return status.Errorf(codes.FailedPrecondition, "Notification %d is no longer waiting to be sent", id)
+	default:
+		log.ErrorLogger.Printf("Failed to %s notification %d: %v", action, id, err)
+		return status.Errorf(codes.Internal, "Failed to %s notification", action)
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"go-noti-server/internal/log"
+	pb "go-noti-server/protos/notifications"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StreamMessages saves notifications pushed on a long-lived stream in batches and acks each
+// batch with the assigned IDs. At most one batch is buffered while the previous one is written,
+// so a producer outpacing the database is slowed down by gRPC flow control rather than
+// growing memory.
+func (s *server) StreamMessages(stream pb.NotificationService_StreamMessagesServer) error {
+	if s.draining.Load() {
+		return status.Errorf(codes.Unavailable, "Server is shutting down")
+	}
+
+	var (
+		batchSize = s.streamBatchSize
+		incoming  = make(chan *pb.NotificationRequest, batchSize)
+		recvErr   = make(chan error, 1)
+	)
+
+	go func() {
+		defer close(incoming)
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					recvErr <- err
+				}
+				return
+			}
+
+			select {
+			case incoming <- req:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(s.streamFlushInterval)
+	defer ticker.Stop()
+
+	var (
+		pending  []*pb.NotificationRequest
+		received int
+	)
+
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+
+		results, _, err := saveBatch(pending, received-len(pending))
+		if err != nil {
+			return err
+		}
+		pending = nil
+
+		return stream.Send(&pb.StreamMessagesAck{Results: results})
+	}
+
+	for {
+		select {
+		case req, ok := <-incoming:
+			if !ok {
+				if err := flush(); err != nil {
+					return err
+				}
+
+				select {
+				case err := <-recvErr:
+					log.InfoLogger.Printf("StreamMessages ended after %d notifications: %v", received, err)
+					return err
+				default:
+					log.InfoLogger.Printf("StreamMessages finished after %d notifications", received)
+					return nil
+				}
+			}
+
+			pending = append(pending, req)
+			received++
+
+			if len(pending) >= batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+
+			if s.draining.Load() {
+				return status.Errorf(codes.Unavailable, "Server is shutting down")
+			}
+		}
+	}
+}
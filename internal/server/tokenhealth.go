@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/notification"
+	pb "go-noti-server/protos/notifications"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultDeadTokenLimit = 500
+	maxDeadTokenLimit     = 5000
+)
+
+func (s *server) ListDeadTokens(ctx context.Context, req *pb.ListDeadTokensRequest) (*pb.ListDeadTokensResponse, error) {
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultDeadTokenLimit
+	}
+	if limit > maxDeadTokenLimit {
+		limit = maxDeadTokenLimit
+	}
+
+	var afterID uint64
+	if req.GetPageToken() != "" {
+		var err error
+		afterID, err = strconv.ParseUint(req.GetPageToken(), 10, 64)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid page token")
+		}
+	}
+
+	var since time.Time
+	if req.GetSince() != nil {
+		since = req.GetSince().AsTime()
+	}
+
+	entries, err := notification.FetchDeadTokens(since, uint(afterID), limit)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to list dead tokens: %v", err)
+		return nil, status.Errorf(codes.Internal, "Failed to list dead tokens")
+	}
+
+	resp := &pb.ListDeadTokensResponse{}
+	for _, e := range entries {
+		resp.Tokens = append(resp.Tokens, &pb.DeadToken{
+			Token:          e.Token,
+			ErrorCode:      e.ErrorCode,
+			Error:          e.Error,
+			FailureCount:   int32(e.FailureCount),
+			NotificationId: uint64(e.NotificationID),
+			FirstFailedAt:  timestamppb.New(e.FirstFailedAt),
+			LastFailedAt:   timestamppb.New(e.LastFailedAt),
+		})
+	}
+
+	if len(entries) == limit {
+		resp.NextPageToken = strconv.FormatUint(uint64(entries[len(entries)-1].ID), 10)
+	}
+	return resp, nil
+}
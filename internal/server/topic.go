@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/notification"
+	pb "go-noti-server/protos/notifications"
+
+	"firebase.google.com/go/v4/messaging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *server) SubscribeToTopic(ctx context.Context, req *pb.TopicSubscriptionRequest) (*pb.TopicSubscriptionResponse, error) {
+	if err := validateTopicRequest(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := notification.SubscribeToTopic(ctx, req.GetDeviceTokens(), req.GetTopic())
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to subscribe to topic %s: %v", req.GetTopic(), err)
+		return nil, status.Errorf(codes.Internal, "Failed to subscribe to topic")
+	}
+
+	log.InfoLogger.Printf("Subscribed %d tokens to topic %s, %d failed", resp.SuccessCount, req.GetTopic(), resp.FailureCount)
+	return topicResponseToProto(req.GetDeviceTokens(), resp), nil
+}
+
+func (s *server) UnsubscribeFromTopic(ctx context.Context, req *pb.TopicSubscriptionRequest) (*pb.TopicSubscriptionResponse, error) {
+	if err := validateTopicRequest(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := notification.UnsubscribeFromTopic(ctx, req.GetDeviceTokens(), req.GetTopic())
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to unsubscribe from topic %s: %v", req.GetTopic(), err)
+		return nil, status.Errorf(codes.Internal, "Failed to unsubscribe from topic")
+	}
+
+	log.InfoLogger.Printf("Unsubscribed %d tokens from topic %s, %d failed", resp.SuccessCount, req.GetTopic(), resp.FailureCount)
+	return topicResponseToProto(req.GetDeviceTokens(), resp), nil
+}
+
+func validateTopicRequest(req *pb.TopicSubscriptionRequest) error {
+	if req.GetTopic() == "" {
+		return status.Errorf(codes.InvalidArgument, "Topic is required")
+	}
+	if err := notification.ValidateTopic(req.GetTopic()); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if len(req.GetDeviceTokens()) == 0 {
+		return status.Errorf(codes.InvalidArgument, "No device tokens")
+	}
+	return nil
+}
+
+func topicResponseToProto(tokens []string, resp *messaging.TopicManagementResponse) *pb.TopicSubscriptionResponse {
+	out := &pb.TopicSubscriptionResponse{
+		SuccessCount: int32(resp.SuccessCount),
+		FailureCount: int32(resp.FailureCount),
+	}
+
+	for _, e := range resp.Errors {
+		topicErr := &pb.TopicSubscriptionError{Index: int32(e.Index), Reason: e.Reason}
+		if e.Index >= 0 && e.Index < len(tokens) {
+			topicErr.Token = tokens[e.Index]
+		}
+		out.Errors = append(out.Errors, topicErr)
+	}
+	return out
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"go-noti-server/config"
 	"go-noti-server/internal/cleanup"
+	"go-noti-server/internal/dispatcher"
 	"go-noti-server/internal/log"
 	"go-noti-server/internal/notification"
 	"go-noti-server/internal/server"
-	"sync"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -15,59 +19,120 @@ func main() {
 	config.LoadEnv()
 	log.SetupLoggers()
 
-	db, err := notification.InitDB()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	notification.SetRetryPolicy(notification.RetryPolicy{
+		MaxAttempts: config.GetInt("RETRY_MAX_ATTEMPTS", 5),
+		BaseDelay:   config.GetDuration("RETRY_BASE_DELAY", 30*time.Second),
+		MaxDelay:    config.GetDuration("RETRY_MAX_DELAY", time.Hour),
+	})
+
+	notification.SetIdempotencyWindow(config.GetDuration("IDEMPOTENCY_WINDOW", 24*time.Hour))
+
+	_, err := notification.InitDB(notification.StoreConfig{
+		Driver:      os.Getenv("DB_DRIVER"),
+		DSN:         os.Getenv("DB_DSN"),
+		BusyTimeout: config.GetDuration("SQLITE_BUSY_TIMEOUT", 5*time.Second),
+	}, config.GetBool("DB_AUTO_MIGRATE", true))
 	if err != nil {
-		log.ErrorLogger.Printf("Error INIT DB: %v", err)
+		log.ErrorLogger.Fatalf("Failed to initialise database: %v", err)
 	}
 
-	err = db.Exec("CREATE INDEX IF NOT EXISTS idx_notification_processing ON notifications (processing);").Error
+	err = notification.InitSender(ctx, notification.SenderConfig{
+		CredentialsFile: os.Getenv("AUTH_FILE"),
+		ReloadInterval:  config.GetDuration("CREDENTIALS_RELOAD_INTERVAL", time.Minute),
+		Parallelism:     config.GetInt("FCM_SEND_PARALLELISM", 4),
+	})
 	if err != nil {
-		log.ErrorLogger.Fatalf("Failed to create index: %v", err)
+		log.ErrorLogger.Fatalf("Failed to initialise Firebase: %v", err)
 	}
 
-	notificationChan := make(chan notification.Notification, 10)
+	notificationChan := make(chan notification.Notification, config.GetInt("WORKER_BUFFER_SIZE", 10))
 
-	for i := 0; i < 10; i++ {
-		go notification.Worker(i, notificationChan)
+	pool := notification.NewPool(notificationChan, config.GetInt("WORKER_MAX_COUNT", 100))
+	if err := pool.Resize(config.GetInt("WORKER_COUNT", 10)); err != nil {
+		log.ErrorLogger.Fatalf("Failed to start workers: %v", err)
 	}
 
-	go func() {
-		for {
-			var notifications []notification.Notification
-			var mu sync.Mutex
-
-			mu.Lock()
-			if err := db.Where("processed = ? AND processing = ?", false, false).Find(&notifications).Error; err != nil {
-				log.InfoLogger.Printf("Failed to query notifications: %v", err)
-				time.Sleep(5 * time.Second)
-				continue
-			}
-			mu.Unlock()
-
-			for _, notif := range notifications {
-				// Update the notification to indicate it's being processed
-				mu.Lock()
-				db.Model(&notification.Notification{}).Where("id = ?", notif.ID).Update("processing", true)
-				mu.Unlock()
-
-				select {
-				case notificationChan <- notif:
-					// Successfully sent notification to the channel
-				default:
-					// Channel is full, handle overflow
-					log.ErrorLogger.Printf("Notification channel is full, dropping notification: %v", notif.ID)
-					mu.Lock()
-					db.Model(&notification.Notification{}).Where("id = ?", notif.ID).Update("processing", false) // Reset processing
-					mu.Unlock()
-				}
-			}
+	d := dispatcher.New(dispatcher.Config{
+		BatchSize:       config.GetInt("DISPATCH_BATCH_SIZE", 100),
+		PollInterval:    config.GetDuration("DISPATCH_POLL_INTERVAL", 5*time.Second),
+		LeaseDuration:   config.GetDuration("DISPATCH_LEASE_DURATION", 5*time.Minute),
+		ReclaimInterval: config.GetDuration("DISPATCH_RECLAIM_INTERVAL", time.Minute),
+	}, notificationChan)
 
-			time.Sleep(5 * time.Second) // Sleep to avoid busy waiting
-		}
+	dispatchCtx, stopDispatch := context.WithCancel(ctx)
+	dispatcherDone := make(chan struct{})
+	go func() {
+		d.Run(dispatchCtx)
+		close(dispatcherDone)
 	}()
 
+	retention := cleanup.Policy{
+		Retention: map[notification.Status]time.Duration{
+			notification.StatusSent:            config.GetDuration("RETENTION_SENT", 7*24*time.Hour),
+			notification.StatusPartiallyFailed: config.GetDuration("RETENTION_PARTIALLY_FAILED", 30*24*time.Hour),
+			notification.StatusFailed:          config.GetDuration("RETENTION_FAILED", 30*24*time.Hour),
+			notification.StatusCancelled:       config.GetDuration("RETENTION_CANCELLED", 7*24*time.Hour),
+		},
+		BatchSize: config.GetInt("CLEANUP_BATCH_SIZE", 500),
+	}
+
 	// Runs at midnight
-	cleanup.ScheduleDailyCleanup(24 * time.Hour)
+	cleanup.ScheduleDailyCleanup(retention)
 
-	server.RunGrpcServer()
+	grpcServer, err := server.RunGrpcServer(server.Options{
+		Dispatcher:          d,
+		Pool:                pool,
+		StreamBatchSize:     config.GetInt("STREAM_BATCH_SIZE", 100),
+		StreamFlushInterval: config.GetDuration("STREAM_FLUSH_INTERVAL", 500*time.Millisecond),
+		Retention:           retention,
+	})
+	if err != nil {
+		log.ErrorLogger.Fatalf("Failed to listen: %v", err)
+	}
+
+	<-ctx.Done()
+	stop()
+	log.InfoLogger.Printf("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.GetDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+
+	grpcServer.Shutdown(shutdownCtx)
+
+	stopDispatch()
+	<-dispatcherDone
+
+	buffered, err := pool.Shutdown(shutdownCtx)
+	if err != nil {
+		// Busy workers may still send what they hold, so only the notifications no worker took
+		// go back to the queue. The rest is reclaimed once its lease expires.
+		log.ErrorLogger.Printf("Workers did not finish in time: %v", err)
+		for _, n := range buffered {
+			if err := notification.ReleaseLease(n.ID, d.Owner()); err != nil {
+				log.ErrorLogger.Printf("Failed to release notification %d: %v", n.ID, err)
+			}
+		}
+	} else {
+		// Every worker is done, whatever is still leased was buffered and goes back to the queue
+		released, err := notification.ReleaseLeases(d.Owner())
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to release leases: %v", err)
+		} else if released > 0 {
+			log.InfoLogger.Printf("Released %d unfinished notifications", released)
+		}
+	}
+
+	log.NewRelicApp.Shutdown(10 * time.Second)
+
+	if err := notification.CloseDB(); err != nil {
+		log.ErrorLogger.Printf("Failed to close database: %v", err)
+	}
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"go-noti-server/config"
+	"go-noti-server/internal/log"
+	"go-noti-server/internal/migrate"
+	"go-noti-server/internal/notification"
+	"os"
+	"strconv"
+	"time"
+)
+
+const migrateUsage = "usage: go-noti-server migrate [up | down [steps] | status]"
+
+// runMigrate handles the migrate subcommand: up applies every pending migration, including the
+// manual ones the server leaves alone, down reverts the last steps (default 1) and status lists
+// what is applied and pending
+func runMigrate(args []string) {
+	db, err := notification.OpenDB(notification.StoreConfig{
+		Driver:      os.Getenv("DB_DRIVER"),
+		DSN:         os.Getenv("DB_DSN"),
+		BusyTimeout: config.GetDuration("SQLITE_BUSY_TIMEOUT", 5*time.Second),
+	})
+	if err != nil {
+		log.ErrorLogger.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer notification.CloseDB()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrate.Up(db, notification.Migrations)
+		if err != nil {
+			log.ErrorLogger.Fatalf("Migration failed after applying %d: %v", applied, err)
+		}
+		log.InfoLogger.Printf("Applied %d migrations", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.ErrorLogger.Fatalf("Invalid number of steps %q\n%s", args[1], migrateUsage)
+			}
+		}
+
+		reverted, err := migrate.Down(db, notification.Migrations, steps)
+		if err != nil {
+			log.ErrorLogger.Fatalf("Revert failed after reverting %d: %v", reverted, err)
+		}
+		log.InfoLogger.Printf("Reverted %d migrations", reverted)
+
+	case "status":
+		applied, err := migrate.Applied(db)
+		if err != nil {
+			log.ErrorLogger.Fatalf("Failed to read schema version: %v", err)
+		}
+
+		done := map[int]bool{}
+		for _, a := range applied {
+			done[a.Version] = true
+			fmt.Printf("%4d  %-32s applied %s\n", a.Version, a.Name, a.AppliedAt.Format("2006-01-02 15:04:05"))
+		}
+		for _, m := range notification.Migrations {
+			if done[m.Version] {
+				continue
+			}
+			if m.Manual {
+				fmt.Printf("%4d  %-32s pending, manual\n", m.Version, m.Name)
+			} else {
+				fmt.Printf("%4d  %-32s pending\n", m.Version, m.Name)
+			}
+		}
+		if _, err := migrate.Check(db, notification.Migrations); err != nil {
+			fmt.Println(err)
+		}
+
+	default:
+		log.ErrorLogger.Fatalf("Unknown migrate command %q\n%s", command, migrateUsage)
+	}
+}
@@ -19,7 +19,29 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	NotificationService_SendMessage_FullMethodName = "/notifications.NotificationService/SendMessage"
+	NotificationService_SendMessage_FullMethodName            = "/notifications.NotificationService/SendMessage"
+	NotificationService_SendMessages_FullMethodName           = "/notifications.NotificationService/SendMessages"
+	NotificationService_StreamMessages_FullMethodName         = "/notifications.NotificationService/StreamMessages"
+	NotificationService_GetNotificationStatus_FullMethodName  = "/notifications.NotificationService/GetNotificationStatus"
+	NotificationService_GetRecipientHistory_FullMethodName    = "/notifications.NotificationService/GetRecipientHistory"
+	NotificationService_WatchDeliveryEvents_FullMethodName    = "/notifications.NotificationService/WatchDeliveryEvents"
+	NotificationService_SubscribeToTopic_FullMethodName       = "/notifications.NotificationService/SubscribeToTopic"
+	NotificationService_UnsubscribeFromTopic_FullMethodName   = "/notifications.NotificationService/UnsubscribeFromTopic"
+	NotificationService_RegisterDevice_FullMethodName         = "/notifications.NotificationService/RegisterDevice"
+	NotificationService_UpdateDevice_FullMethodName           = "/notifications.NotificationService/UpdateDevice"
+	NotificationService_RemoveDevices_FullMethodName          = "/notifications.NotificationService/RemoveDevices"
+	NotificationService_ListDevices_FullMethodName            = "/notifications.NotificationService/ListDevices"
+	NotificationService_RescheduleNotification_FullMethodName = "/notifications.NotificationService/RescheduleNotification"
+	NotificationService_CancelNotification_FullMethodName     = "/notifications.NotificationService/CancelNotification"
+	NotificationService_ListDeadLetters_FullMethodName        = "/notifications.NotificationService/ListDeadLetters"
+	NotificationService_GetDeadLetter_FullMethodName          = "/notifications.NotificationService/GetDeadLetter"
+	NotificationService_ReplayDeadLetters_FullMethodName      = "/notifications.NotificationService/ReplayDeadLetters"
+	NotificationService_PurgeDeadLetters_FullMethodName       = "/notifications.NotificationService/PurgeDeadLetters"
+	NotificationService_ListDeadTokens_FullMethodName         = "/notifications.NotificationService/ListDeadTokens"
+	NotificationService_GetQueueStats_FullMethodName          = "/notifications.NotificationService/GetQueueStats"
+	NotificationService_GetWorkerPool_FullMethodName          = "/notifications.NotificationService/GetWorkerPool"
+	NotificationService_ScaleWorkerPool_FullMethodName        = "/notifications.NotificationService/ScaleWorkerPool"
+	NotificationService_DryRunCleanup_FullMethodName          = "/notifications.NotificationService/DryRunCleanup"
 )
 
 // NotificationServiceClient is the client API for NotificationService service.
@@ -27,6 +49,31 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type NotificationServiceClient interface {
 	SendMessage(ctx context.Context, in *NotificationRequest, opts ...grpc.CallOption) (*NotificationResponse, error)
+	SendMessages(ctx context.Context, in *SendMessagesRequest, opts ...grpc.CallOption) (*SendMessagesResponse, error)
+	// Producers keep the stream open and push notifications; acks come back as each batch is saved
+	StreamMessages(ctx context.Context, opts ...grpc.CallOption) (NotificationService_StreamMessagesClient, error)
+	GetNotificationStatus(ctx context.Context, in *GetNotificationStatusRequest, opts ...grpc.CallOption) (*NotificationStatus, error)
+	// Which notifications a device token, topic or user was sent and how each of them went
+	GetRecipientHistory(ctx context.Context, in *RecipientHistoryRequest, opts ...grpc.CallOption) (*RecipientHistoryResponse, error)
+	WatchDeliveryEvents(ctx context.Context, in *WatchDeliveryEventsRequest, opts ...grpc.CallOption) (NotificationService_WatchDeliveryEventsClient, error)
+	SubscribeToTopic(ctx context.Context, in *TopicSubscriptionRequest, opts ...grpc.CallOption) (*TopicSubscriptionResponse, error)
+	UnsubscribeFromTopic(ctx context.Context, in *TopicSubscriptionRequest, opts ...grpc.CallOption) (*TopicSubscriptionResponse, error)
+	RegisterDevice(ctx context.Context, in *Device, opts ...grpc.CallOption) (*Device, error)
+	UpdateDevice(ctx context.Context, in *Device, opts ...grpc.CallOption) (*Device, error)
+	RemoveDevices(ctx context.Context, in *RemoveDevicesRequest, opts ...grpc.CallOption) (*RemoveDevicesResponse, error)
+	ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error)
+	RescheduleNotification(ctx context.Context, in *RescheduleNotificationRequest, opts ...grpc.CallOption) (*NotificationStatus, error)
+	CancelNotification(ctx context.Context, in *CancelNotificationRequest, opts ...grpc.CallOption) (*NotificationStatus, error)
+	ListDeadLetters(ctx context.Context, in *ListDeadLettersRequest, opts ...grpc.CallOption) (*ListDeadLettersResponse, error)
+	GetDeadLetter(ctx context.Context, in *GetDeadLetterRequest, opts ...grpc.CallOption) (*DeadLetter, error)
+	ReplayDeadLetters(ctx context.Context, in *ReplayDeadLettersRequest, opts ...grpc.CallOption) (*ReplayDeadLettersResponse, error)
+	PurgeDeadLetters(ctx context.Context, in *PurgeDeadLettersRequest, opts ...grpc.CallOption) (*PurgeDeadLettersResponse, error)
+	ListDeadTokens(ctx context.Context, in *ListDeadTokensRequest, opts ...grpc.CallOption) (*ListDeadTokensResponse, error)
+	GetQueueStats(ctx context.Context, in *QueueStatsRequest, opts ...grpc.CallOption) (*QueueStatsResponse, error)
+	GetWorkerPool(ctx context.Context, in *WorkerPoolRequest, opts ...grpc.CallOption) (*WorkerPoolResponse, error)
+	ScaleWorkerPool(ctx context.Context, in *ScaleWorkerPoolRequest, opts ...grpc.CallOption) (*WorkerPoolResponse, error)
+	// Reports what the retention policy would delete if cleanup ran now, without deleting anything
+	DryRunCleanup(ctx context.Context, in *DryRunCleanupRequest, opts ...grpc.CallOption) (*CleanupReport, error)
 }
 
 type notificationServiceClient struct {
@@ -46,11 +93,279 @@ func (c *notificationServiceClient) SendMessage(ctx context.Context, in *Notific
 	return out, nil
 }
 
+func (c *notificationServiceClient) SendMessages(ctx context.Context, in *SendMessagesRequest, opts ...grpc.CallOption) (*SendMessagesResponse, error) {
+	out := new(SendMessagesResponse)
+	err := c.cc.Invoke(ctx, NotificationService_SendMessages_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) StreamMessages(ctx context.Context, opts ...grpc.CallOption) (NotificationService_StreamMessagesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &NotificationService_ServiceDesc.Streams[0], NotificationService_StreamMessages_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &notificationServiceStreamMessagesClient{stream}
+	return x, nil
+}
+
+type NotificationService_StreamMessagesClient interface {
+	Send(*NotificationRequest) error
+	Recv() (*StreamMessagesAck, error)
+	grpc.ClientStream
+}
+
+type notificationServiceStreamMessagesClient struct {
+	grpc.ClientStream
+}
+
+func (x *notificationServiceStreamMessagesClient) Send(m *NotificationRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *notificationServiceStreamMessagesClient) Recv() (*StreamMessagesAck, error) {
+	m := new(StreamMessagesAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *notificationServiceClient) GetNotificationStatus(ctx context.Context, in *GetNotificationStatusRequest, opts ...grpc.CallOption) (*NotificationStatus, error) {
+	out := new(NotificationStatus)
+	err := c.cc.Invoke(ctx, NotificationService_GetNotificationStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) GetRecipientHistory(ctx context.Context, in *RecipientHistoryRequest, opts ...grpc.CallOption) (*RecipientHistoryResponse, error) {
+	out := new(RecipientHistoryResponse)
+	err := c.cc.Invoke(ctx, NotificationService_GetRecipientHistory_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) WatchDeliveryEvents(ctx context.Context, in *WatchDeliveryEventsRequest, opts ...grpc.CallOption) (NotificationService_WatchDeliveryEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &NotificationService_ServiceDesc.Streams[1], NotificationService_WatchDeliveryEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &notificationServiceWatchDeliveryEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type NotificationService_WatchDeliveryEventsClient interface {
+	Recv() (*DeliveryEvent, error)
+	grpc.ClientStream
+}
+
+type notificationServiceWatchDeliveryEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *notificationServiceWatchDeliveryEventsClient) Recv() (*DeliveryEvent, error) {
+	m := new(DeliveryEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *notificationServiceClient) SubscribeToTopic(ctx context.Context, in *TopicSubscriptionRequest, opts ...grpc.CallOption) (*TopicSubscriptionResponse, error) {
+	out := new(TopicSubscriptionResponse)
+	err := c.cc.Invoke(ctx, NotificationService_SubscribeToTopic_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) UnsubscribeFromTopic(ctx context.Context, in *TopicSubscriptionRequest, opts ...grpc.CallOption) (*TopicSubscriptionResponse, error) {
+	out := new(TopicSubscriptionResponse)
+	err := c.cc.Invoke(ctx, NotificationService_UnsubscribeFromTopic_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) RegisterDevice(ctx context.Context, in *Device, opts ...grpc.CallOption) (*Device, error) {
+	out := new(Device)
+	err := c.cc.Invoke(ctx, NotificationService_RegisterDevice_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) UpdateDevice(ctx context.Context, in *Device, opts ...grpc.CallOption) (*Device, error) {
+	out := new(Device)
+	err := c.cc.Invoke(ctx, NotificationService_UpdateDevice_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) RemoveDevices(ctx context.Context, in *RemoveDevicesRequest, opts ...grpc.CallOption) (*RemoveDevicesResponse, error) {
+	out := new(RemoveDevicesResponse)
+	err := c.cc.Invoke(ctx, NotificationService_RemoveDevices_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error) {
+	out := new(ListDevicesResponse)
+	err := c.cc.Invoke(ctx, NotificationService_ListDevices_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) RescheduleNotification(ctx context.Context, in *RescheduleNotificationRequest, opts ...grpc.CallOption) (*NotificationStatus, error) {
+	out := new(NotificationStatus)
+	err := c.cc.Invoke(ctx, NotificationService_RescheduleNotification_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) CancelNotification(ctx context.Context, in *CancelNotificationRequest, opts ...grpc.CallOption) (*NotificationStatus, error) {
+	out := new(NotificationStatus)
+	err := c.cc.Invoke(ctx, NotificationService_CancelNotification_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) ListDeadLetters(ctx context.Context, in *ListDeadLettersRequest, opts ...grpc.CallOption) (*ListDeadLettersResponse, error) {
+	out := new(ListDeadLettersResponse)
+	err := c.cc.Invoke(ctx, NotificationService_ListDeadLetters_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) GetDeadLetter(ctx context.Context, in *GetDeadLetterRequest, opts ...grpc.CallOption) (*DeadLetter, error) {
+	out := new(DeadLetter)
+	err := c.cc.Invoke(ctx, NotificationService_GetDeadLetter_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) ReplayDeadLetters(ctx context.Context, in *ReplayDeadLettersRequest, opts ...grpc.CallOption) (*ReplayDeadLettersResponse, error) {
+	out := new(ReplayDeadLettersResponse)
+	err := c.cc.Invoke(ctx, NotificationService_ReplayDeadLetters_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) PurgeDeadLetters(ctx context.Context, in *PurgeDeadLettersRequest, opts ...grpc.CallOption) (*PurgeDeadLettersResponse, error) {
+	out := new(PurgeDeadLettersResponse)
+	err := c.cc.Invoke(ctx, NotificationService_PurgeDeadLetters_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) ListDeadTokens(ctx context.Context, in *ListDeadTokensRequest, opts ...grpc.CallOption) (*ListDeadTokensResponse, error) {
+	out := new(ListDeadTokensResponse)
+	err := c.cc.Invoke(ctx, NotificationService_ListDeadTokens_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) GetQueueStats(ctx context.Context, in *QueueStatsRequest, opts ...grpc.CallOption) (*QueueStatsResponse, error) {
+	out := new(QueueStatsResponse)
+	err := c.cc.Invoke(ctx, NotificationService_GetQueueStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) GetWorkerPool(ctx context.Context, in *WorkerPoolRequest, opts ...grpc.CallOption) (*WorkerPoolResponse, error) {
+	out := new(WorkerPoolResponse)
+	err := c.cc.Invoke(ctx, NotificationService_GetWorkerPool_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) ScaleWorkerPool(ctx context.Context, in *ScaleWorkerPoolRequest, opts ...grpc.CallOption) (*WorkerPoolResponse, error) {
+	out := new(WorkerPoolResponse)
+	err := c.cc.Invoke(ctx, NotificationService_ScaleWorkerPool_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *notificationServiceClient) DryRunCleanup(ctx context.Context, in *DryRunCleanupRequest, opts ...grpc.CallOption) (*CleanupReport, error) {
+	out := new(CleanupReport)
+	err := c.cc.Invoke(ctx, NotificationService_DryRunCleanup_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // NotificationServiceServer is the server API for NotificationService service.
 // All implementations must embed UnimplementedNotificationServiceServer
 // for forward compatibility
 type NotificationServiceServer interface {
 	SendMessage(context.Context, *NotificationRequest) (*NotificationResponse, error)
+	SendMessages(context.Context, *SendMessagesRequest) (*SendMessagesResponse, error)
+	// Producers keep the stream open and push notifications; acks come back as each batch is saved
+	StreamMessages(NotificationService_StreamMessagesServer) error
+	GetNotificationStatus(context.Context, *GetNotificationStatusRequest) (*NotificationStatus, error)
+	// Which notifications a device token, topic or user was sent and how each of them went
+	GetRecipientHistory(context.Context, *RecipientHistoryRequest) (*RecipientHistoryResponse, error)
+	WatchDeliveryEvents(*WatchDeliveryEventsRequest, NotificationService_WatchDeliveryEventsServer) error
+	SubscribeToTopic(context.Context, *TopicSubscriptionRequest) (*TopicSubscriptionResponse, error)
+	UnsubscribeFromTopic(context.Context, *TopicSubscriptionRequest) (*TopicSubscriptionResponse, error)
+	RegisterDevice(context.Context, *Device) (*Device, error)
+	UpdateDevice(context.Context, *Device) (*Device, error)
+	RemoveDevices(context.Context, *RemoveDevicesRequest) (*RemoveDevicesResponse, error)
+	ListDevices(context.Context, *ListDevicesRequest) (*ListDevicesResponse, error)
+	RescheduleNotification(context.Context, *RescheduleNotificationRequest) (*NotificationStatus, error)
+	CancelNotification(context.Context, *CancelNotificationRequest) (*NotificationStatus, error)
+	ListDeadLetters(context.Context, *ListDeadLettersRequest) (*ListDeadLettersResponse, error)
+	GetDeadLetter(context.Context, *GetDeadLetterRequest) (*DeadLetter, error)
+	ReplayDeadLetters(context.Context, *ReplayDeadLettersRequest) (*ReplayDeadLettersResponse, error)
+	PurgeDeadLetters(context.Context, *PurgeDeadLettersRequest) (*PurgeDeadLettersResponse, error)
+	ListDeadTokens(context.Context, *ListDeadTokensRequest) (*ListDeadTokensResponse, error)
+	GetQueueStats(context.Context, *QueueStatsRequest) (*QueueStatsResponse, error)
+	GetWorkerPool(context.Context, *WorkerPoolRequest) (*WorkerPoolResponse, error)
+	ScaleWorkerPool(context.Context, *ScaleWorkerPoolRequest) (*WorkerPoolResponse, error)
+	// Reports what the retention policy would delete if cleanup ran now, without deleting anything
+	DryRunCleanup(context.Context, *DryRunCleanupRequest) (*CleanupReport, error)
 	mustEmbedUnimplementedNotificationServiceServer()
 }
 
@@ -61,6 +376,72 @@ type UnimplementedNotificationServiceServer struct {
 func (UnimplementedNotificationServiceServer) SendMessage(context.Context, *NotificationRequest) (*NotificationResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendMessage not implemented")
 }
+func (UnimplementedNotificationServiceServer) SendMessages(context.Context, *SendMessagesRequest) (*SendMessagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendMessages not implemented")
+}
+func (UnimplementedNotificationServiceServer) StreamMessages(NotificationService_StreamMessagesServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamMessages not implemented")
+}
+func (UnimplementedNotificationServiceServer) GetNotificationStatus(context.Context, *GetNotificationStatusRequest) (*NotificationStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNotificationStatus not implemented")
+}
+func (UnimplementedNotificationServiceServer) GetRecipientHistory(context.Context, *RecipientHistoryRequest) (*RecipientHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRecipientHistory not implemented")
+}
+func (UnimplementedNotificationServiceServer) WatchDeliveryEvents(*WatchDeliveryEventsRequest, NotificationService_WatchDeliveryEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchDeliveryEvents not implemented")
+}
+func (UnimplementedNotificationServiceServer) SubscribeToTopic(context.Context, *TopicSubscriptionRequest) (*TopicSubscriptionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubscribeToTopic not implemented")
+}
+func (UnimplementedNotificationServiceServer) UnsubscribeFromTopic(context.Context, *TopicSubscriptionRequest) (*TopicSubscriptionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnsubscribeFromTopic not implemented")
+}
+func (UnimplementedNotificationServiceServer) RegisterDevice(context.Context, *Device) (*Device, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterDevice not implemented")
+}
+func (UnimplementedNotificationServiceServer) UpdateDevice(context.Context, *Device) (*Device, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateDevice not implemented")
+}
+func (UnimplementedNotificationServiceServer) RemoveDevices(context.Context, *RemoveDevicesRequest) (*RemoveDevicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveDevices not implemented")
+}
+func (UnimplementedNotificationServiceServer) ListDevices(context.Context, *ListDevicesRequest) (*ListDevicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDevices not implemented")
+}
+func (UnimplementedNotificationServiceServer) RescheduleNotification(context.Context, *RescheduleNotificationRequest) (*NotificationStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RescheduleNotification not implemented")
+}
+func (UnimplementedNotificationServiceServer) CancelNotification(context.Context, *CancelNotificationRequest) (*NotificationStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelNotification not implemented")
+}
+func (UnimplementedNotificationServiceServer) ListDeadLetters(context.Context, *ListDeadLettersRequest) (*ListDeadLettersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDeadLetters not implemented")
+}
+func (UnimplementedNotificationServiceServer) GetDeadLetter(context.Context, *GetDeadLetterRequest) (*DeadLetter, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDeadLetter not implemented")
+}
+func (UnimplementedNotificationServiceServer) ReplayDeadLetters(context.Context, *ReplayDeadLettersRequest) (*ReplayDeadLettersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReplayDeadLetters not implemented")
+}
+func (UnimplementedNotificationServiceServer) PurgeDeadLetters(context.Context, *PurgeDeadLettersRequest) (*PurgeDeadLettersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeDeadLetters not implemented")
+}
+func (UnimplementedNotificationServiceServer) ListDeadTokens(context.Context, *ListDeadTokensRequest) (*ListDeadTokensResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDeadTokens not implemented")
+}
+func (UnimplementedNotificationServiceServer) GetQueueStats(context.Context, *QueueStatsRequest) (*QueueStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetQueueStats not implemented")
+}
+func (UnimplementedNotificationServiceServer) GetWorkerPool(context.Context, *WorkerPoolRequest) (*WorkerPoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetWorkerPool not implemented")
+}
+func (UnimplementedNotificationServiceServer) ScaleWorkerPool(context.Context, *ScaleWorkerPoolRequest) (*WorkerPoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScaleWorkerPool not implemented")
+}
+func (UnimplementedNotificationServiceServer) DryRunCleanup(context.Context, *DryRunCleanupRequest) (*CleanupReport, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DryRunCleanup not implemented")
+}
 func (UnimplementedNotificationServiceServer) mustEmbedUnimplementedNotificationServiceServer() {}
 
 // UnsafeNotificationServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -92,6 +473,413 @@ func _NotificationService_SendMessage_Handler(srv interface{}, ctx context.Conte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _NotificationService_SendMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendMessagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).SendMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_SendMessages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).SendMessages(ctx, req.(*SendMessagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_StreamMessages_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(NotificationServiceServer).StreamMessages(&notificationServiceStreamMessagesServer{stream})
+}
+
+type NotificationService_StreamMessagesServer interface {
+	Send(*StreamMessagesAck) error
+	Recv() (*NotificationRequest, error)
+	grpc.ServerStream
+}
+
+type notificationServiceStreamMessagesServer struct {
+	grpc.ServerStream
+}
+
+func (x *notificationServiceStreamMessagesServer) Send(m *StreamMessagesAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *notificationServiceStreamMessagesServer) Recv() (*NotificationRequest, error) {
+	m := new(NotificationRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _NotificationService_GetNotificationStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetNotificationStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).GetNotificationStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_GetNotificationStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).GetNotificationStatus(ctx, req.(*GetNotificationStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_GetRecipientHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecipientHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).GetRecipientHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_GetRecipientHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).GetRecipientHistory(ctx, req.(*RecipientHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_WatchDeliveryEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchDeliveryEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NotificationServiceServer).WatchDeliveryEvents(m, &notificationServiceWatchDeliveryEventsServer{stream})
+}
+
+type NotificationService_WatchDeliveryEventsServer interface {
+	Send(*DeliveryEvent) error
+	grpc.ServerStream
+}
+
+type notificationServiceWatchDeliveryEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *notificationServiceWatchDeliveryEventsServer) Send(m *DeliveryEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _NotificationService_SubscribeToTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TopicSubscriptionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).SubscribeToTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_SubscribeToTopic_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).SubscribeToTopic(ctx, req.(*TopicSubscriptionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_UnsubscribeFromTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TopicSubscriptionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).UnsubscribeFromTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_UnsubscribeFromTopic_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).UnsubscribeFromTopic(ctx, req.(*TopicSubscriptionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_RegisterDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Device)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).RegisterDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_RegisterDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).RegisterDevice(ctx, req.(*Device))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_UpdateDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Device)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).UpdateDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_UpdateDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).UpdateDevice(ctx, req.(*Device))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_RemoveDevices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveDevicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).RemoveDevices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_RemoveDevices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).RemoveDevices(ctx, req.(*RemoveDevicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_ListDevices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDevicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).ListDevices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_ListDevices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).ListDevices(ctx, req.(*ListDevicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_RescheduleNotification_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RescheduleNotificationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).RescheduleNotification(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_RescheduleNotification_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).RescheduleNotification(ctx, req.(*RescheduleNotificationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_CancelNotification_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelNotificationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).CancelNotification(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_CancelNotification_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).CancelNotification(ctx, req.(*CancelNotificationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_ListDeadLetters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDeadLettersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).ListDeadLetters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_ListDeadLetters_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).ListDeadLetters(ctx, req.(*ListDeadLettersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_GetDeadLetter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeadLetterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).GetDeadLetter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_GetDeadLetter_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).GetDeadLetter(ctx, req.(*GetDeadLetterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_ReplayDeadLetters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplayDeadLettersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).ReplayDeadLetters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_ReplayDeadLetters_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).ReplayDeadLetters(ctx, req.(*ReplayDeadLettersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_PurgeDeadLetters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeDeadLettersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).PurgeDeadLetters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_PurgeDeadLetters_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).PurgeDeadLetters(ctx, req.(*PurgeDeadLettersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_ListDeadTokens_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDeadTokensRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).ListDeadTokens(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_ListDeadTokens_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).ListDeadTokens(ctx, req.(*ListDeadTokensRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_GetQueueStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).GetQueueStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_GetQueueStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).GetQueueStats(ctx, req.(*QueueStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_GetWorkerPool_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WorkerPoolRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).GetWorkerPool(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_GetWorkerPool_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).GetWorkerPool(ctx, req.(*WorkerPoolRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_ScaleWorkerPool_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScaleWorkerPoolRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).ScaleWorkerPool(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_ScaleWorkerPool_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).ScaleWorkerPool(ctx, req.(*ScaleWorkerPoolRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NotificationService_DryRunCleanup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DryRunCleanupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NotificationServiceServer).DryRunCleanup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NotificationService_DryRunCleanup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NotificationServiceServer).DryRunCleanup(ctx, req.(*DryRunCleanupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // NotificationService_ServiceDesc is the grpc.ServiceDesc for NotificationService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -103,7 +891,99 @@ var NotificationService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SendMessage",
 			Handler:    _NotificationService_SendMessage_Handler,
 		},
+		{
+			MethodName: "SendMessages",
+			Handler:    _NotificationService_SendMessages_Handler,
+		},
+		{
+			MethodName: "GetNotificationStatus",
+			Handler:    _NotificationService_GetNotificationStatus_Handler,
+		},
+		{
+			MethodName: "GetRecipientHistory",
+			Handler:    _NotificationService_GetRecipientHistory_Handler,
+		},
+		{
+			MethodName: "SubscribeToTopic",
+			Handler:    _NotificationService_SubscribeToTopic_Handler,
+		},
+		{
+			MethodName: "UnsubscribeFromTopic",
+			Handler:    _NotificationService_UnsubscribeFromTopic_Handler,
+		},
+		{
+			MethodName: "RegisterDevice",
+			Handler:    _NotificationService_RegisterDevice_Handler,
+		},
+		{
+			MethodName: "UpdateDevice",
+			Handler:    _NotificationService_UpdateDevice_Handler,
+		},
+		{
+			MethodName: "RemoveDevices",
+			Handler:    _NotificationService_RemoveDevices_Handler,
+		},
+		{
+			MethodName: "ListDevices",
+			Handler:    _NotificationService_ListDevices_Handler,
+		},
+		{
+			MethodName: "RescheduleNotification",
+			Handler:    _NotificationService_RescheduleNotification_Handler,
+		},
+		{
+			MethodName: "CancelNotification",
+			Handler:    _NotificationService_CancelNotification_Handler,
+		},
+		{
+			MethodName: "ListDeadLetters",
+			Handler:    _NotificationService_ListDeadLetters_Handler,
+		},
+		{
+			MethodName: "GetDeadLetter",
+			Handler:    _NotificationService_GetDeadLetter_Handler,
+		},
+		{
+			MethodName: "ReplayDeadLetters",
+			Handler:    _NotificationService_ReplayDeadLetters_Handler,
+		},
+		{
+			MethodName: "PurgeDeadLetters",
+			Handler:    _NotificationService_PurgeDeadLetters_Handler,
+		},
+		{
+			MethodName: "ListDeadTokens",
+			Handler:    _NotificationService_ListDeadTokens_Handler,
+		},
+		{
+			MethodName: "GetQueueStats",
+			Handler:    _NotificationService_GetQueueStats_Handler,
+		},
+		{
+			MethodName: "GetWorkerPool",
+			Handler:    _NotificationService_GetWorkerPool_Handler,
+		},
+		{
+			MethodName: "ScaleWorkerPool",
+			Handler:    _NotificationService_ScaleWorkerPool_Handler,
+		},
+		{
+			MethodName: "DryRunCleanup",
+			Handler:    _NotificationService_DryRunCleanup_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamMessages",
+			Handler:       _NotificationService_StreamMessages_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchDeliveryEvents",
+			Handler:       _NotificationService_WatchDeliveryEvents_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "create.proto",
 }